@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// batchModes are the probe modes that can be listed in a batch file.
+var batchModes = []string{"tcp", "udp", "stun", "turn", "tls", "tls-insecure", "tls-sni", "tls-postgres", "tls-ldap", "http", "http2", "websocket"}
+
+// batchTarget is a single probe read from a batch file.
+type batchTarget struct {
+	line         int
+	name         string
+	mode         string
+	host         string
+	port         int
+	sni          string
+	alpn         []string
+	count        int
+	transport    string
+	turnUser     string
+	turnPassword string
+	turnSecret   string
+	url          string
+	insecure     bool
+	mattermost   bool
+	token        string
+	wsDuration   time.Duration
+}
+
+// batchResult is the outcome of a single batch probe.
+type batchResult struct {
+	target  batchTarget
+	success bool
+	latency time.Duration
+	detail  string
+	err     error
+}
+
+// address returns the host:port or URL a target probes, for display.
+func (t batchTarget) address() string {
+	switch t.mode {
+	case "http", "websocket":
+		return mattermostBaseURL(t.url, t.host, t.port)
+	default:
+		return net.JoinHostPort(t.host, strconv.Itoa(t.port))
+	}
+}
+
+// splitBatchLine splits a batch file line into arguments at whitespace. As in a shell,
+// single or double quotes group words and are removed, e.g. -turn-secret 'a secret'.
+func splitBatchLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// parseBatchLine parses one batch file line. Lines use the same flags as the command
+// line, e.g. `-name db -mode tls-postgres -host db.internal -port 5432`.
+func parseBatchLine(line string, number int) (batchTarget, error) {
+	target := batchTarget{line: number}
+	var alpn string
+
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&target.name, "name", "", "")
+	fs.StringVar(&target.mode, "mode", "tcp", "")
+	fs.StringVar(&target.host, "host", "", "")
+	fs.IntVar(&target.port, "port", 443, "")
+	fs.StringVar(&target.sni, "sni", "", "")
+	fs.StringVar(&alpn, "alpn", "", "")
+	fs.IntVar(&target.count, "count", 3, "")
+	fs.StringVar(&target.transport, "transport", "udp", "")
+	fs.StringVar(&target.turnUser, "turn-user", "", "")
+	fs.StringVar(&target.turnPassword, "turn-password", "", "")
+	fs.StringVar(&target.turnSecret, "turn-secret", "", "")
+	fs.StringVar(&target.url, "url", "", "")
+	fs.BoolVar(&target.insecure, "insecure", false, "")
+	fs.BoolVar(&target.mattermost, "mattermost", false, "")
+	fs.StringVar(&target.token, "token", "", "")
+	fs.DurationVar(&target.wsDuration, "ws-duration", 5*time.Second, "")
+
+	args, err := splitBatchLine(line)
+	if err != nil {
+		return target, fmt.Errorf("line %d: %w", number, err)
+	}
+	if err := fs.Parse(args); err != nil {
+		return target, fmt.Errorf("line %d: %w", number, err)
+	}
+	if fs.NArg() > 0 {
+		return target, fmt.Errorf("line %d: unexpected argument '%s'", number, fs.Arg(0))
+	}
+
+	target.mode = strings.ToLower(target.mode)
+	target.transport = strings.ToLower(target.transport)
+	if alpn != "" {
+		target.alpn = strings.Split(alpn, ",")
+	}
+
+	supported := false
+	for _, mode := range batchModes {
+		if target.mode == mode {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return target, fmt.Errorf("line %d: mode '%s' is not supported in batch files (use %s)", number, target.mode, strings.Join(batchModes, ", "))
+	}
+
+	if target.host == "" && target.url != "" {
+		if u, err := url.Parse(target.url); err == nil {
+			target.host = u.Hostname()
+		}
+	}
+	if target.host == "" {
+		return target, fmt.Errorf("line %d: host is required", number)
+	}
+	if target.mode == "tls-sni" && target.sni == "" {
+		return target, fmt.Errorf("line %d: SNI is required for tls-sni mode", number)
+	}
+
+	portSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			portSet = true
+		}
+	})
+	if !portSet && (target.mode == "stun" || target.mode == "turn") {
+		target.port = stunDefaultPort
+		if target.transport == "tls" {
+			target.port = stunDefaultTLSPort
+		}
+	}
+
+	if target.name == "" {
+		target.name = target.host
+	}
+	return target, nil
+}
+
+// parseBatchFile reads the targets of a batch file. Blank lines and lines starting
+// with # are ignored.
+func parseBatchFile(path string) ([]batchTarget, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch file: %w", err)
+	}
+	defer file.Close()
+
+	targets, err := readBatchTargets(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found in %s", path)
+	}
+
+	return targets, nil
+}
+
+// readBatchTargets parses the lines of a batch file, skipping blank lines and comments.
+func readBatchTargets(r io.Reader) ([]batchTarget, error) {
+	var targets []batchTarget
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target, err := parseBatchLine(line, number)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch file: %w", err)
+	}
+
+	return targets, nil
+}
+
+// runBatchProbe runs the probe for a single target without printing anything.
+func runBatchProbe(target batchTarget, dialer *probeDialer) *batchResult {
+	result := &batchResult{target: target}
+	start := time.Now()
+
+	switch target.mode {
+	case "tcp":
+		result.err = testTCPConnection(target.host, target.port, dialer)
+		result.success = result.err == nil
+		result.detail = "connected"
+
+	case "udp":
+		r := testUDPConnection(target.host, target.port, target.count, dialer)
+		result.success, result.err = r.success(), r.err
+		result.detail = fmt.Sprintf("%d/%d replies", r.received, r.sent)
+		if r.refused {
+			result.detail = "port unreachable"
+		}
+		if len(r.rtts) > 0 {
+			result.latency = avgDuration(r.rtts)
+		}
+
+	case "stun":
+		r := testSTUNBinding(target.host, target.port, target.transport, dialer)
+		result.success, result.err, result.latency = r.success, r.err, r.rtt
+		result.detail = fmt.Sprintf("reflexive %s (%s)", r.reflexive, r.transport)
+
+	case "turn":
+		username, password := target.turnUser, target.turnPassword
+		if target.turnSecret != "" {
+			username, password = turnCredentialsFromSecret(target.turnUser, target.turnSecret)
+		}
+		r := testTURNAllocate(target.host, target.port, target.transport, username, password, dialer)
+		result.success, result.err, result.latency = r.success, r.err, r.rtt
+		result.detail = fmt.Sprintf("relayed %s (%s)", r.relayed, r.transport)
+
+	case "tls", "tls-insecure", "tls-sni", "tls-postgres", "tls-ldap":
+		var r *tlsTestResult
+		switch target.mode {
+		case "tls":
+			r = testTLSHandshake(target.host, target.port, target.alpn, dialer)
+		case "tls-insecure":
+			r = testTLSHandshakeInsecure(target.host, target.port, target.alpn, dialer)
+		case "tls-sni":
+			r = testTLSHandshakeWithSNI(target.host, target.port, target.sni, target.alpn, dialer)
+		case "tls-postgres":
+			r = testPostgresSTARTTLS(target.host, target.port, target.alpn, dialer)
+		case "tls-ldap":
+			r = testLDAPSTARTTLS(target.host, target.port, target.alpn, dialer)
+		}
+		result.success, result.err = r.success, r.err
+		result.detail = tlsVersionString(r.version)
+		if r.negotiatedProtocol != "" {
+			result.detail += ", ALPN " + r.negotiatedProtocol
+		}
+
+	case "http":
+		address := target.address()
+		if target.mattermost {
+			address += mattermostPingPath
+		}
+		r := testHTTPRequest(address, target.sni, target.insecure, dialer)
+		result.success, result.err, result.latency = r.success, r.err, r.timings.total
+		result.detail = r.status
+		// An unhealthy server answers the ping with 500 and the status JSON.
+		if r.statusCode != 0 && target.mattermost {
+			status, err := GetMattermostPing(r)
+			switch {
+			case err == nil:
+				// The unhealthy fields say more than the HTTP status.
+				if unhealthy := unhealthyPingFields(status); len(unhealthy) > 0 {
+					result.success, result.err = false, nil
+					result.detail = strings.Join(unhealthy, ", ")
+				}
+			case result.success:
+				result.success, result.err = false, err
+			}
+		}
+
+	case "http2":
+		r := testHTTP2(target.host, target.port, target.sni, target.insecure, dialer)
+		result.success, result.err, result.latency = r.success, r.err, r.rtt
+		result.detail = fmt.Sprintf("ALPN %s, %d settings", alpnString(r.negotiatedProtocol), len(r.settings))
+
+	case "websocket":
+		r := testWebSocket(target.address(), target.sni, target.token, target.insecure, dialer, target.wsDuration)
+		result.success, result.err, result.latency = r.success(target.token), r.err, r.handshake
+		result.detail = fmt.Sprintf("%s, open %v", r.status, r.survived.Round(time.Millisecond))
+	}
+
+	if result.latency == 0 {
+		result.latency = time.Since(start)
+	}
+	if !result.success && result.err != nil {
+		result.detail = result.err.Error()
+		if info := classifyConnError(result.err); info.hint != "" {
+			result.detail = info.name + ": " + info.hint
+		}
+	}
+	return result
+}
+
+// runBatch probes all targets with at most workers probes in flight. Results are
+// returned in the order of the batch file.
+func runBatch(targets []batchTarget, workers int, dialer *probeDialer) []*batchResult {
+	results := make([]*batchResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runBatchProbe(targets[i], dialer)
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// PrintBatch runs every target of a batch file concurrently and prints a summary table.
+// It returns the number of failed targets.
+func PrintBatch(path string, workers int, dialer *probeDialer) (int, error) {
+	targets, err := parseBatchFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	start := time.Now()
+	results := runBatch(targets, workers, dialer)
+	elapsed := time.Since(start)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Line", "Name", "Mode", "Target", "Status", "Latency", "Detail"})
+
+	failed := 0
+	for _, result := range results {
+		status := text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
+		if !result.success {
+			status = text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
+			failed++
+		}
+		t.AppendRow(table.Row{
+			result.target.line,
+			result.target.name,
+			result.target.mode,
+			result.target.address(),
+			status,
+			result.latency.Round(time.Microsecond),
+			result.detail,
+		})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Batch Results (%s, %d workers, %v):", path, workers, elapsed.Round(time.Millisecond)))
+	t.Render()
+
+	color := text.Colors{text.Bold, text.FgGreen}
+	if failed > 0 {
+		color = text.Colors{text.Bold, text.FgRed}
+	}
+	fmt.Printf("%s\n", color.Sprintf("%d/%d targets OK", len(results)-failed, len(results)))
+
+	return failed, nil
+}
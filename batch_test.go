@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitBatchLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", line: "-mode tcp  -host\tdb", want: []string{"-mode", "tcp", "-host", "db"}},
+		{name: "single quotes", line: "-turn-secret 'static-auth-secret'", want: []string{"-turn-secret", "static-auth-secret"}},
+		{name: "quoted spaces", line: `-token "a b" -name 'x y'`, want: []string{"-token", "a b", "-name", "x y"}},
+		{name: "quote inside word", line: `-name=a'b c'd`, want: []string{"-name=ab cd"}},
+		{name: "other quote kept", line: `-name "it's"`, want: []string{"-name", "it's"}},
+		{name: "empty quoted value", line: "-turn-secret ''", want: []string{"-turn-secret", ""}},
+		{name: "unterminated", line: "-turn-secret 'secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitBatchLine(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("splitBatchLine = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitBatchLine: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitBatchLine = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		check   func(t *testing.T, target batchTarget)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			line: "-host db.internal",
+			check: func(t *testing.T, target batchTarget) {
+				if target.mode != "tcp" || target.port != 443 || target.name != "db.internal" || target.count != 3 {
+					t.Errorf("target = %+v", target)
+				}
+			},
+		},
+		{
+			// The command line defaults to 30s; a batch must not wait that long per websocket.
+			name: "ws-duration default",
+			line: "-mode websocket -url wss://chat.example.com",
+			check: func(t *testing.T, target batchTarget) {
+				if target.wsDuration != 5*time.Second {
+					t.Errorf("wsDuration = %v, want 5s", target.wsDuration)
+				}
+				if target.host != "chat.example.com" {
+					t.Errorf("host = %q, want host from -url", target.host)
+				}
+			},
+		},
+		{
+			name: "quoted secret",
+			line: "-name turn -mode turn -host turn.example.com -turn-user calls -turn-secret 'static-auth-secret'",
+			check: func(t *testing.T, target batchTarget) {
+				if target.turnSecret != "static-auth-secret" {
+					t.Errorf("turnSecret = %q", target.turnSecret)
+				}
+				if target.port != stunDefaultPort {
+					t.Errorf("port = %d, want %d", target.port, stunDefaultPort)
+				}
+			},
+		},
+		{
+			name: "stun over tls default port",
+			line: "-mode STUN -transport TLS -host turn.example.com",
+			check: func(t *testing.T, target batchTarget) {
+				if target.mode != "stun" || target.transport != "tls" || target.port != stunDefaultTLSPort {
+					t.Errorf("target = %+v", target)
+				}
+			},
+		},
+		{
+			name: "alpn list",
+			line: "-mode tls -host chat.example.com -alpn h2,http/1.1",
+			check: func(t *testing.T, target batchTarget) {
+				if !reflect.DeepEqual(target.alpn, []string{"h2", "http/1.1"}) {
+					t.Errorf("alpn = %q", target.alpn)
+				}
+			},
+		},
+		{name: "unknown flag", line: "-host db -retries 3", wantErr: "line 7: flag provided but not defined: -retries"},
+		{name: "unsupported mode", line: "-mode sysctl -host db", wantErr: "line 7: mode 'sysctl' is not supported"},
+		{name: "unexpected argument", line: "-host db extra", wantErr: "line 7: unexpected argument 'extra'"},
+		{name: "missing host", line: "-mode tcp -port 5432", wantErr: "line 7: host is required"},
+		{name: "tls-sni without sni", line: "-mode tls-sni -host db", wantErr: "line 7: SNI is required"},
+		{name: "unterminated quote", line: "-host db -token 'abc", wantErr: "line 7: unterminated ' quote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := parseBatchLine(tt.line, 7)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("parseBatchLine error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBatchLine: %v", err)
+			}
+			if target.line != 7 {
+				t.Errorf("line = %d, want 7", target.line)
+			}
+			tt.check(t, target)
+		})
+	}
+}
+
+func TestReadBatchTargets(t *testing.T) {
+	input := `# Mattermost production
+
+-name db -mode tls-postgres -host db.internal -port 5432
+   # indented comment
+-name app -mode http -url https://chat.example.com -mattermost
+`
+	targets, err := readBatchTargets(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readBatchTargets: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(targets))
+	}
+	if targets[0].name != "db" || targets[0].line != 3 || targets[1].name != "app" || targets[1].line != 5 {
+		t.Errorf("targets = %+v", targets)
+	}
+
+	if _, err := readBatchTargets(strings.NewReader("-host db\n-mode nope -host db\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("readBatchTargets error = %v, want line 2 error", err)
+	}
+}
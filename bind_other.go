@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDeviceControl returns a dialer Control function that always fails, since
+// SO_BINDTODEVICE is Linux-specific.
+func bindToDeviceControl(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("binding to interface %s is %w", iface, errUnsupportedPlatform)
+	}
+}
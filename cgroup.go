@@ -0,0 +1,418 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prometheus/procfs"
+)
+
+// cgroupRoot is where the cgroup v2 unified hierarchy is mounted. Tests point it at a
+// fixture directory.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// processCgroupDir returns the cgroup v2 directory of proc under cgroupRoot. The path
+// in /proc/<pid>/cgroup is relative to this process's cgroup namespace, which is the
+// namespace cgroupRoot is mounted for.
+func processCgroupDir(proc *procfs.Proc) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted at %s: %w", cgroupRoot, err)
+	}
+
+	cgroups, err := proc.Cgroups()
+	if err != nil {
+		return "", fmt.Errorf("failed to read cgroups of PID %d: %w", proc.PID, err)
+	}
+	for _, cgroup := range cgroups {
+		if cgroup.HierarchyID == 0 && len(cgroup.Controllers) == 0 {
+			return filepath.Join(cgroupRoot, cgroup.Path), nil
+		}
+	}
+
+	return "", fmt.Errorf("PID %d is not in a cgroup v2 hierarchy", proc.PID)
+}
+
+// readCgroupFile returns the trimmed content of an interface file of a cgroup.
+func readCgroupFile(dir, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// cgroupAncestors returns dir and its parents up to cgroupRoot, innermost first.
+func cgroupAncestors(dir string) []string {
+	dirs := []string{dir}
+	for dir != cgroupRoot && strings.HasPrefix(dir, cgroupRoot+"/") {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// cgroupCPULimit returns the lowest cpu.max quota of dir and its ancestors in CPUs, and
+// the cgroup setting it. The root cgroup has no cpu.max, so ok is false without a limit.
+func cgroupCPULimit(dir string) (cpus float64, source string, ok bool) {
+	cpus = math.Inf(1)
+	for _, d := range cgroupAncestors(dir) {
+		value, err := readCgroupFile(d, "cpu.max")
+		if err != nil {
+			continue
+		}
+		quota, period, _ := strings.Cut(value, " ")
+		if quota == "max" {
+			continue
+		}
+		q, err := strconv.ParseFloat(quota, 64)
+		if err != nil {
+			continue
+		}
+		p, err := strconv.ParseFloat(period, 64)
+		if err != nil || p == 0 {
+			continue
+		}
+		if q/p < cpus {
+			cpus, source = q/p, d
+		}
+	}
+	return cpus, source, source != ""
+}
+
+// cgroupMemoryLimit returns the lowest memory.max of dir and its ancestors in bytes,
+// and the cgroup setting it.
+func cgroupMemoryLimit(dir string) (limit uint64, source string, ok bool) {
+	limit = math.MaxUint64
+	for _, d := range cgroupAncestors(dir) {
+		value, err := readCgroupFile(d, "memory.max")
+		if err != nil || value == "max" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if n < limit {
+			limit, source = n, d
+		}
+	}
+	return limit, source, source != ""
+}
+
+// Thresholds above which the cgroup mode reports a resource as close to its limit.
+const (
+	cgroupMemoryWarnPercent   = 90
+	cgroupPidsWarnPercent     = 80
+	cgroupThrottleWarnPercent = 10
+)
+
+// cgroupInfo holds the cgroup v2 interface files of the Mattermost cgroup. Values are
+// empty, and maps nil, when the controller is not enabled for the cgroup.
+type cgroupInfo struct {
+	pid               int
+	dir               string
+	memoryMax         string
+	memoryLimit       uint64
+	memoryLimitSource string
+	memoryLimited     bool
+	memoryCurrent     string
+	memoryHigh        string
+	memorySwapMax     string
+	memorySwapCurrent string
+	memoryEvents      map[string]uint64
+	cpuMax            string
+	cpuLimit          float64
+	cpuLimitSource    string
+	cpuLimited        bool
+	cpuStat           map[string]uint64
+	pidsMax           string
+	pidsCurrent       string
+	ioMax             []string
+	ioEnabled         bool
+}
+
+// readCgroupKeyedFile parses a flat keyed interface file such as memory.events or cpu.stat.
+func readCgroupKeyedFile(dir, name string) (map[string]uint64, error) {
+	content, err := readCgroupFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+	return values, nil
+}
+
+// blockDeviceName returns the kernel name of the block device major:minor, or
+// major:minor itself if it is unknown.
+func blockDeviceName(majorMinor string) string {
+	uevent, err := os.ReadFile("/sys/dev/block/" + majorMinor + "/uevent")
+	if err != nil {
+		return majorMinor
+	}
+	for _, line := range strings.Split(string(uevent), "\n") {
+		if name, ok := strings.CutPrefix(line, "DEVNAME="); ok {
+			return name + " (" + majorMinor + ")"
+		}
+	}
+	return majorMinor
+}
+
+// memoryUsage returns memory.current as a percentage of the effective memory limit.
+func (c *cgroupInfo) memoryUsage() (float64, bool) {
+	current, err := strconv.ParseUint(c.memoryCurrent, 10, 64)
+	if err != nil || !c.memoryLimited || c.memoryLimit == 0 {
+		return 0, false
+	}
+	return float64(current) * 100 / float64(c.memoryLimit), true
+}
+
+// pidsUsage returns pids.current as a percentage of pids.max.
+func (c *cgroupInfo) pidsUsage() (float64, bool) {
+	current, err := strconv.ParseUint(c.pidsCurrent, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	limit, err := strconv.ParseUint(c.pidsMax, 10, 64)
+	if err != nil || limit == 0 {
+		return 0, false
+	}
+	return float64(current) * 100 / float64(limit), true
+}
+
+// throttled returns the percentage of CFS periods in which the cgroup was throttled.
+func (c *cgroupInfo) throttled() (float64, bool) {
+	periods := c.cpuStat["nr_periods"]
+	if periods == 0 {
+		return 0, false
+	}
+	return float64(c.cpuStat["nr_throttled"]) * 100 / float64(periods), true
+}
+
+// problems returns the resources of the cgroup that are at or near their limits.
+func (c *cgroupInfo) problems() []string {
+	var problems []string
+	if c.memoryEvents["oom_kill"] > 0 {
+		problems = append(problems, "oom_kill")
+	}
+	if usage, ok := c.memoryUsage(); ok && usage >= cgroupMemoryWarnPercent {
+		problems = append(problems, "memory")
+	}
+	if usage, ok := c.throttled(); ok && usage >= cgroupThrottleWarnPercent {
+		problems = append(problems, "cpu throttling")
+	}
+	if usage, ok := c.pidsUsage(); ok && usage >= cgroupPidsWarnPercent {
+		problems = append(problems, "pids")
+	}
+	return problems
+}
+
+// summary returns the usage of the cgroup in one line.
+func (c *cgroupInfo) summary() string {
+	parts := []string{"memory " + formatCgroupBytes(c.memoryCurrent)}
+	if usage, ok := c.memoryUsage(); ok {
+		parts[0] += fmt.Sprintf(" (%.1f%%)", usage)
+	}
+	parts = append(parts, fmt.Sprintf("oom_kill %d", c.memoryEvents["oom_kill"]))
+	if usage, ok := c.throttled(); ok {
+		parts = append(parts, fmt.Sprintf("throttled %.1f%%", usage))
+	}
+	if c.pidsCurrent != "" {
+		parts = append(parts, "pids "+c.pidsCurrent)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetMattermostCgroup reads the memory, cpu, pids and io interface files of the cgroup
+// v2 the Mattermost process runs in.
+func GetMattermostCgroup(selector *processSelector) (*cgroupInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := processCgroupDir(proc)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &cgroupInfo{pid: proc.PID, dir: dir}
+	info.memoryMax, _ = readCgroupFile(dir, "memory.max")
+	info.memoryCurrent, _ = readCgroupFile(dir, "memory.current")
+	info.memoryHigh, _ = readCgroupFile(dir, "memory.high")
+	info.memorySwapMax, _ = readCgroupFile(dir, "memory.swap.max")
+	info.memorySwapCurrent, _ = readCgroupFile(dir, "memory.swap.current")
+	info.memoryEvents, _ = readCgroupKeyedFile(dir, "memory.events")
+	info.memoryLimit, info.memoryLimitSource, info.memoryLimited = cgroupMemoryLimit(dir)
+
+	info.cpuMax, _ = readCgroupFile(dir, "cpu.max")
+	info.cpuStat, _ = readCgroupKeyedFile(dir, "cpu.stat")
+	info.cpuLimit, info.cpuLimitSource, info.cpuLimited = cgroupCPULimit(dir)
+
+	info.pidsMax, _ = readCgroupFile(dir, "pids.max")
+	info.pidsCurrent, _ = readCgroupFile(dir, "pids.current")
+
+	// io.max is empty until a limit is set, so its presence tells whether io is enabled.
+	if ioMax, err := readCgroupFile(dir, "io.max"); err == nil {
+		info.ioEnabled = true
+		for _, line := range strings.Split(ioMax, "\n") {
+			device, limits, ok := strings.Cut(line, " ")
+			if ok {
+				info.ioMax = append(info.ioMax, blockDeviceName(device)+": "+limits)
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// formatCgroupBytes formats a byte value of a cgroup interface file, keeping "max".
+func formatCgroupBytes(value string) string {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return formatBytes(n)
+}
+
+// PrintMattermostCgroup prints the cgroup v2 limits and usage of the Mattermost process.
+// It returns false if a resource is near its limit or the OOM killer was invoked.
+func PrintMattermostCgroup(selector *processSelector) (bool, error) {
+	info, err := GetMattermostCgroup(selector)
+	if err != nil {
+		return false, err
+	}
+
+	notEnabled := text.Colors{text.Faint}.Sprint("(controller not enabled)")
+	ok := text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
+	warn := text.Colors{text.Bold, text.FgYellow}.Sprint("WARN")
+	fail := text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
+	inherited := func(limited bool, source, limit string) string {
+		if limited && source != info.dir {
+			return fmt.Sprintf(" (effective %s from %s)", limit, source)
+		}
+		return ""
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Setting", "Value", "Status"})
+
+	if info.memoryCurrent == "" {
+		t.AppendRow(table.Row{"memory", notEnabled, ""})
+	} else {
+		t.AppendRow(table.Row{"memory.max", formatCgroupBytes(info.memoryMax) +
+			inherited(info.memoryLimited, info.memoryLimitSource, formatBytes(info.memoryLimit)), ""})
+		if usage, limited := info.memoryUsage(); limited {
+			status := ok
+			if usage >= cgroupMemoryWarnPercent {
+				status = warn
+			}
+			t.AppendRow(table.Row{"memory.current", fmt.Sprintf("%s (%.1f%% of limit)", formatCgroupBytes(info.memoryCurrent), usage), status})
+		} else {
+			t.AppendRow(table.Row{"memory.current", formatCgroupBytes(info.memoryCurrent), ok})
+		}
+		t.AppendRow(table.Row{"memory.high", formatCgroupBytes(info.memoryHigh), ""})
+		if info.memorySwapMax != "" {
+			t.AppendRow(table.Row{"memory.swap.max", formatCgroupBytes(info.memorySwapMax), ""})
+			t.AppendRow(table.Row{"memory.swap.current", formatCgroupBytes(info.memorySwapCurrent), ""})
+		}
+		status := ok
+		if info.memoryEvents["oom_kill"] > 0 {
+			status = fail
+		}
+		t.AppendRow(table.Row{"memory.events", fmt.Sprintf("oom_kill %d, oom %d, max %d, high %d",
+			info.memoryEvents["oom_kill"], info.memoryEvents["oom"], info.memoryEvents["max"], info.memoryEvents["high"]), status})
+	}
+
+	if info.cpuMax == "" {
+		t.AppendRow(table.Row{"cpu", notEnabled, ""})
+	} else {
+		value := info.cpuMax
+		if quota, period, _ := strings.Cut(info.cpuMax, " "); quota != "max" {
+			q, _ := strconv.ParseFloat(quota, 64)
+			p, _ := strconv.ParseFloat(period, 64)
+			if p > 0 {
+				value += fmt.Sprintf(" (%.2f CPUs)", q/p)
+			}
+		}
+		t.AppendRow(table.Row{"cpu.max", value +
+			inherited(info.cpuLimited, info.cpuLimitSource, fmt.Sprintf("%.2f CPUs", info.cpuLimit)), ""})
+		if usage, limited := info.throttled(); limited {
+			status := ok
+			if usage >= cgroupThrottleWarnPercent {
+				status = warn
+			}
+			t.AppendRow(table.Row{"cpu.stat throttled", fmt.Sprintf("%d of %d periods (%.1f%%), %v",
+				info.cpuStat["nr_throttled"], info.cpuStat["nr_periods"], usage,
+				time.Duration(info.cpuStat["throttled_usec"])*time.Microsecond), status})
+		}
+	}
+	if info.cpuStat != nil {
+		t.AppendRow(table.Row{"cpu.stat usage", fmt.Sprintf("%v (user %v, system %v)",
+			time.Duration(info.cpuStat["usage_usec"])*time.Microsecond,
+			time.Duration(info.cpuStat["user_usec"])*time.Microsecond,
+			time.Duration(info.cpuStat["system_usec"])*time.Microsecond), ""})
+	}
+
+	if info.pidsCurrent == "" {
+		t.AppendRow(table.Row{"pids", notEnabled, ""})
+	} else {
+		t.AppendRow(table.Row{"pids.max", info.pidsMax, ""})
+		if usage, limited := info.pidsUsage(); limited {
+			status := ok
+			if usage >= cgroupPidsWarnPercent {
+				status = warn
+			}
+			t.AppendRow(table.Row{"pids.current", fmt.Sprintf("%s (%.1f%% of limit)", info.pidsCurrent, usage), status})
+		} else {
+			t.AppendRow(table.Row{"pids.current", info.pidsCurrent, ok})
+		}
+	}
+
+	switch {
+	case !info.ioEnabled:
+		t.AppendRow(table.Row{"io", notEnabled, ""})
+	case len(info.ioMax) == 0:
+		t.AppendRow(table.Row{"io.max", "max", ""})
+	default:
+		for i, limit := range info.ioMax {
+			label := ""
+			if i == 0 {
+				label = "io.max"
+			}
+			t.AppendRow(table.Row{label, limit, ""})
+		}
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Mattermost Cgroup (PID %d):", info.pid))
+	fmt.Printf("  Path: %s\n", info.dir)
+	t.Render()
+
+	problems := info.problems()
+	if len(problems) > 0 {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("At or near cgroup limits: %s", strings.Join(problems, ", ")))
+	}
+
+	return len(problems) == 0, nil
+}
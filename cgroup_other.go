@@ -0,0 +1,33 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// cgroupInfo holds the cgroup v2 interface files of the Mattermost cgroup.
+type cgroupInfo struct {
+	pid int
+	dir string
+}
+
+// problems returns the resources of the cgroup that are at or near their limits.
+func (c *cgroupInfo) problems() []string {
+	return nil
+}
+
+// summary returns the usage of the cgroup in one line.
+func (c *cgroupInfo) summary() string {
+	return ""
+}
+
+// GetMattermostCgroup is not available outside Linux, where cgroup v2 is used.
+func GetMattermostCgroup(selector *processSelector) (*cgroupInfo, error) {
+	return nil, fmt.Errorf("cgroup inspection is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostCgroup is not available outside Linux, where cgroup v2 is used.
+func PrintMattermostCgroup(selector *processSelector) (bool, error) {
+	return false, fmt.Errorf("cgroup inspection is %w", errUnsupportedPlatform)
+}
@@ -0,0 +1,224 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeCgroupFixture creates a cgroup tree under a temporary cgroupRoot. files maps
+// paths relative to the root, such as "system.slice/cpu.max", to their content.
+func writeCgroupFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	previous := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = previous })
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestReadCgroupKeyedFile(t *testing.T) {
+	root := writeCgroupFixture(t, map[string]string{
+		"memory.events": "low 0\nhigh 12\nmax 3\noom 1\noom_kill 1\noom_group_kill 0\n",
+		"cpu.stat":      "usage_usec 8123456\nnr_periods 200\nnr_throttled 25\nthrottled_usec 51234\nbroken\nsome_key not-a-number\n",
+	})
+
+	events, err := readCgroupKeyedFile(root, "memory.events")
+	if err != nil {
+		t.Fatalf("readCgroupKeyedFile: %v", err)
+	}
+	want := map[string]uint64{"low": 0, "high": 12, "max": 3, "oom": 1, "oom_kill": 1, "oom_group_kill": 0}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("memory.events = %v, want %v", events, want)
+	}
+
+	stat, err := readCgroupKeyedFile(root, "cpu.stat")
+	if err != nil {
+		t.Fatalf("readCgroupKeyedFile: %v", err)
+	}
+	want = map[string]uint64{"usage_usec": 8123456, "nr_periods": 200, "nr_throttled": 25, "throttled_usec": 51234}
+	if !reflect.DeepEqual(stat, want) {
+		t.Errorf("cpu.stat = %v, want %v", stat, want)
+	}
+
+	if _, err := readCgroupKeyedFile(root, "io.stat"); err == nil {
+		t.Error("readCgroupKeyedFile of a missing file succeeded")
+	}
+}
+
+func TestCgroupCPULimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantCPUs   float64
+		wantSource string
+		wantOK     bool
+	}{
+		{
+			name:  "no limit",
+			files: map[string]string{"system.slice/cpu.max": "max 100000", "system.slice/mattermost.service/cpu.max": "max 100000"},
+		},
+		{
+			name:       "own quota",
+			files:      map[string]string{"system.slice/mattermost.service/cpu.max": "150000 100000"},
+			wantCPUs:   1.5,
+			wantSource: "system.slice/mattermost.service",
+			wantOK:     true,
+		},
+		{
+			name: "parent quota is lower",
+			files: map[string]string{
+				"system.slice/cpu.max":                    "200000 100000",
+				"system.slice/mattermost.service/cpu.max": "400000 100000",
+			},
+			wantCPUs:   2,
+			wantSource: "system.slice",
+			wantOK:     true,
+		},
+		{
+			name: "period other than the default",
+			files: map[string]string{
+				"system.slice/cpu.max":                    "max 100000",
+				"system.slice/mattermost.service/cpu.max": "25000 50000",
+			},
+			wantCPUs:   0.5,
+			wantSource: "system.slice/mattermost.service",
+			wantOK:     true,
+		},
+		{
+			name: "malformed values are skipped",
+			files: map[string]string{
+				"system.slice/cpu.max":                    "lots 100000",
+				"system.slice/mattermost.service/cpu.max": "100000 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeCgroupFixture(t, tt.files)
+			cpus, source, ok := cgroupCPULimit(filepath.Join(root, "system.slice/mattermost.service"))
+			if ok != tt.wantOK {
+				t.Fatalf("cgroupCPULimit ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if cpus != tt.wantCPUs || source != filepath.Join(root, tt.wantSource) {
+				t.Errorf("cgroupCPULimit = %v %s, want %v %s", cpus, source, tt.wantCPUs, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestCgroupMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantLimit  uint64
+		wantSource string
+		wantOK     bool
+	}{
+		{
+			name:  "max everywhere",
+			files: map[string]string{"kubepods/memory.max": "max", "kubepods/pod1/memory.max": "max", "kubepods/pod1/ctr/memory.max": "max"},
+		},
+		{
+			name:       "container limit",
+			files:      map[string]string{"kubepods/memory.max": "max", "kubepods/pod1/ctr/memory.max": "4294967296"},
+			wantLimit:  4 << 30,
+			wantSource: "kubepods/pod1/ctr",
+			wantOK:     true,
+		},
+		{
+			name: "pod limit below container limit",
+			files: map[string]string{
+				"kubepods/pod1/memory.max":     "2147483648",
+				"kubepods/pod1/ctr/memory.max": "4294967296",
+			},
+			wantLimit:  2 << 30,
+			wantSource: "kubepods/pod1",
+			wantOK:     true,
+		},
+		{
+			name:       "malformed value is skipped",
+			files:      map[string]string{"kubepods/memory.max": "1073741824", "kubepods/pod1/ctr/memory.max": "1G"},
+			wantLimit:  1 << 30,
+			wantSource: "kubepods",
+			wantOK:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeCgroupFixture(t, tt.files)
+			limit, source, ok := cgroupMemoryLimit(filepath.Join(root, "kubepods/pod1/ctr"))
+			if ok != tt.wantOK {
+				t.Fatalf("cgroupMemoryLimit ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if limit != tt.wantLimit || source != filepath.Join(root, tt.wantSource) {
+				t.Errorf("cgroupMemoryLimit = %d %s, want %d %s", limit, source, tt.wantLimit, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestCgroupInfoProblems(t *testing.T) {
+	const gib = 1 << 30
+	limited := func(current string) cgroupInfo {
+		return cgroupInfo{memoryCurrent: current, memoryLimit: 10 * gib, memoryLimited: true}
+	}
+
+	tests := []struct {
+		name string
+		info cgroupInfo
+		want []string
+	}{
+		{name: "nothing set", info: cgroupInfo{}},
+		{name: "memory below 90%", info: limited("9663676415"), want: nil},
+		{name: "memory at 90%", info: limited("9663676416"), want: []string{"memory"}},
+		{name: "memory without a limit", info: cgroupInfo{memoryCurrent: "9663676416"}},
+		{name: "oom kill", info: cgroupInfo{memoryEvents: map[string]uint64{"oom": 2, "oom_kill": 1}}, want: []string{"oom_kill"}},
+		{name: "oom without kill", info: cgroupInfo{memoryEvents: map[string]uint64{"oom": 2}}},
+		{name: "throttled below 10%", info: cgroupInfo{cpuStat: map[string]uint64{"nr_periods": 1000, "nr_throttled": 99}}},
+		{name: "throttled at 10%", info: cgroupInfo{cpuStat: map[string]uint64{"nr_periods": 1000, "nr_throttled": 100}}, want: []string{"cpu throttling"}},
+		{name: "no cfs periods", info: cgroupInfo{cpuStat: map[string]uint64{"nr_throttled": 5}}},
+		{name: "pids below 80%", info: cgroupInfo{pidsCurrent: "79", pidsMax: "100"}},
+		{name: "pids at 80%", info: cgroupInfo{pidsCurrent: "80", pidsMax: "100"}, want: []string{"pids"}},
+		{name: "pids max", info: cgroupInfo{pidsCurrent: "4000", pidsMax: "max"}},
+		{
+			name: "all at once",
+			info: cgroupInfo{
+				memoryCurrent: "10737418240", memoryLimit: 10 * gib, memoryLimited: true,
+				memoryEvents: map[string]uint64{"oom_kill": 3},
+				cpuStat:      map[string]uint64{"nr_periods": 10, "nr_throttled": 10},
+				pidsCurrent:  "100", pidsMax: "100",
+			},
+			want: []string{"oom_kill", "memory", "cpu throttling", "pids"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.problems(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
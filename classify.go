@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// connErrorClass identifies why a connection attempt failed.
+type connErrorClass int
+
+const (
+	connErrNone connErrorClass = iota
+	connErrDNSNotFound
+	connErrDNSTemporary
+	connErrTimeout
+	connErrRefused
+	connErrHostUnreachable
+	connErrNetUnreachable
+	connErrReset
+	connErrAddrNotAvailable
+	connErrLocalPolicy
+	connErrOther
+)
+
+// connErrorInfo is the classification of a connection error with a likely cause.
+type connErrorInfo struct {
+	class connErrorClass
+	name  string
+	hint  string
+}
+
+// classifyConnError unwraps DNS errors and errno values from err and maps them to a
+// class and a one-line likely cause. Errors are checked from the most specific cause
+// outwards, so a DNS failure inside a proxied dial is still reported as DNS.
+func classifyConnError(err error) connErrorInfo {
+	if err == nil {
+		return connErrorInfo{class: connErrNone, name: "none"}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return connErrorInfo{connErrDNSNotFound, "DNS NXDOMAIN", "host name does not exist — check spelling and DNS search domains"}
+		}
+		return connErrorInfo{connErrDNSTemporary, "DNS temporary failure", "DNS server unreachable or not answering — check /etc/resolv.conf and the resolver"}
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ECONNREFUSED:
+			return connErrorInfo{connErrRefused, "connection refused", "port closed on host — nothing is listening or a firewall rejects with RST"}
+		case syscall.EHOSTUNREACH:
+			return connErrorInfo{connErrHostUnreachable, "host unreachable", "no route — check firewall (ICMP host-prohibited) and that the host is up"}
+		case syscall.ENETUNREACH:
+			return connErrorInfo{connErrNetUnreachable, "network unreachable", "no route to the network — check the routing table and default gateway"}
+		case syscall.ECONNRESET:
+			return connErrorInfo{connErrReset, "connection reset", "reset by peer — a firewall, load balancer or proxy dropped the connection"}
+		case syscall.EADDRNOTAVAIL:
+			return connErrorInfo{connErrAddrNotAvailable, "address not available", "local ephemeral ports exhausted or bind address not configured — compare with ip_local_port_range"}
+		case syscall.EPERM, syscall.EACCES:
+			return connErrorInfo{connErrLocalPolicy, "operation not permitted", "blocked locally — check the host firewall (iptables/nftables) and SELinux"}
+		case syscall.ETIMEDOUT:
+			return connErrorInfo{connErrTimeout, "timeout", "no answer — packets are silently dropped by a firewall or the host is down"}
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return connErrorInfo{connErrTimeout, "timeout", "no answer — packets are silently dropped by a firewall or the host is down"}
+	}
+
+	return connErrorInfo{connErrOther, "other", ""}
+}
+
+// printLikelyCause prints the classification of a failed probe's error, if it is known.
+func printLikelyCause(err error) {
+	info := classifyConnError(err)
+	if info.hint == "" {
+		return
+	}
+	fmt.Printf("  Likely cause (%s): %s\n", info.name, text.Colors{text.FgYellow}.Sprint(info.hint))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// dialError wraps errno like a failed net.Dial does.
+func dialError(errno syscall.Errno) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: errno}}
+}
+
+// timeoutError is a net.Error that reports a timeout without an errno, like the
+// deadline errors of other packages.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "handshake timed out" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyConnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want connErrorClass
+	}{
+		{name: "nil", err: nil, want: connErrNone},
+		{name: "refused", err: dialError(syscall.ECONNREFUSED), want: connErrRefused},
+		{name: "host unreachable", err: dialError(syscall.EHOSTUNREACH), want: connErrHostUnreachable},
+		{name: "network unreachable", err: dialError(syscall.ENETUNREACH), want: connErrNetUnreachable},
+		{name: "reset", err: &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, want: connErrReset},
+		{name: "address not available", err: dialError(syscall.EADDRNOTAVAIL), want: connErrAddrNotAvailable},
+		{name: "not permitted", err: dialError(syscall.EPERM), want: connErrLocalPolicy},
+		{name: "errno timeout", err: dialError(syscall.ETIMEDOUT), want: connErrTimeout},
+		{name: "bare errno", err: syscall.ECONNREFUSED, want: connErrRefused},
+		{name: "wrapped by the probe", err: fmt.Errorf("failed to connect to db.internal:5432: %w", dialError(syscall.ECONNREFUSED)), want: connErrRefused},
+		{
+			name: "dns not found",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db.internal", IsNotFound: true}},
+			want: connErrDNSNotFound,
+		},
+		{
+			name: "dns temporary",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "server misbehaving", Name: "db.internal", IsTemporary: true}},
+			want: connErrDNSTemporary,
+		},
+		{
+			name: "dns timeout is reported as dns",
+			err:  fmt.Errorf("proxy dial: %w", &net.DNSError{Err: "i/o timeout", Name: "db.internal", IsTimeout: true}),
+			want: connErrDNSTemporary,
+		},
+		{name: "deadline exceeded", err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, want: connErrTimeout},
+		{name: "net.Error timeout", err: fmt.Errorf("websocket: %w", timeoutError{}), want: connErrTimeout},
+		{name: "unclassified errno", err: dialError(syscall.EINVAL), want: connErrOther},
+		{name: "plain error", err: errors.New("unexpected status 502"), want: connErrOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := classifyConnError(tt.err)
+			if info.class != tt.want {
+				t.Errorf("classifyConnError(%v) = %q, want class %d", tt.err, info.name, tt.want)
+			}
+			if hasHint := info.hint != ""; hasHint != (tt.want != connErrNone && tt.want != connErrOther) {
+				t.Errorf("classifyConnError(%v) hint = %q", tt.err, info.hint)
+			}
+		})
+	}
+}
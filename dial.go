@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// probeDialer opens the connections used by the network probes. TCP connections can be
+// routed through an HTTP CONNECT or SOCKS5 proxy, either given explicitly or taken from
+// HTTPS_PROXY/NO_PROXY the same way Mattermost's outgoing HTTP client resolves it.
+// UDP is always dialed directly. Outgoing connections can be bound to a source address
+// or, on Linux, to a network interface.
+type probeDialer struct {
+	timeout      time.Duration
+	proxy        *url.URL
+	proxyFromEnv bool
+	bindIP       net.IP
+	iface        string
+
+	proxyProtocol    string
+	proxyProtocolSrc netip.AddrPort
+	proxyProtocolDst netip.AddrPort
+}
+
+// newProbeDialer creates a dialer with the given proxy and binding settings.
+func newProbeDialer(proxyURL string, proxyFromEnv bool, bindIP, iface string, timeout time.Duration) (*probeDialer, error) {
+	d := &probeDialer{
+		timeout:      timeout,
+		proxyFromEnv: proxyFromEnv,
+		iface:        iface,
+	}
+
+	if bindIP != "" {
+		d.bindIP = net.ParseIP(bindIP)
+		if d.bindIP == nil {
+			return nil, fmt.Errorf("invalid bind address '%s'", bindIP)
+		}
+	}
+
+	if iface != "" {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return nil, fmt.Errorf("invalid interface '%s': %w", iface, err)
+		}
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme '%s' (use http, https or socks5)", u.Scheme)
+		}
+		d.proxy = u
+	}
+
+	return d, nil
+}
+
+// setProxyProtocol makes every TCP connection start with a PROXY protocol header of the
+// given version, announcing src and dst (ip:port) instead of the real endpoints if set.
+func (d *probeDialer) setProxyProtocol(version, src, dst string) error {
+	if version != "v1" && version != "v2" {
+		return fmt.Errorf("unsupported PROXY protocol version '%s' (use v1 or v2)", version)
+	}
+	d.proxyProtocol = version
+
+	var err error
+	if src != "" {
+		if d.proxyProtocolSrc, err = netip.ParseAddrPort(src); err != nil {
+			return fmt.Errorf("invalid PROXY header source '%s': %w", src, err)
+		}
+	}
+	if dst != "" {
+		if d.proxyProtocolDst, err = netip.ParseAddrPort(dst); err != nil {
+			return fmt.Errorf("invalid PROXY header destination '%s': %w", dst, err)
+		}
+	}
+	return nil
+}
+
+// proxyForURL returns the proxy to use for a request to target, or nil to connect directly.
+// It is suitable as http.Transport.Proxy.
+func (d *probeDialer) proxyForURL(req *http.Request) (*url.URL, error) {
+	if d.proxy != nil {
+		return d.proxy, nil
+	}
+	if d.proxyFromEnv {
+		return httpproxy.FromEnvironment().ProxyFunc()(req.URL)
+	}
+	return nil, nil
+}
+
+// proxyFor returns the proxy to use for a raw TCP connection to address. Such connections
+// are evaluated like HTTPS requests, since that is how tunneled traffic is proxied.
+func (d *probeDialer) proxyFor(address string) (*url.URL, error) {
+	return d.proxyForURL(&http.Request{URL: &url.URL{Scheme: "https", Host: address}})
+}
+
+// Dial connects to address on the named network.
+func (d *probeDialer) Dial(network, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// directDialer returns the dialer used for connections on network that do not go through
+// a proxy, including the connection to the proxy itself.
+func (d *probeDialer) directDialer(network string) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout: d.timeout,
+	}
+
+	if d.bindIP != nil {
+		if strings.HasPrefix(network, "udp") {
+			dialer.LocalAddr = &net.UDPAddr{IP: d.bindIP}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: d.bindIP}
+		}
+	}
+	if d.iface != "" {
+		dialer.Control = bindToDeviceControl(d.iface)
+	}
+
+	return dialer
+}
+
+// directDialContext dials address without a proxy; it is suitable as http.Transport.DialContext.
+func (d *probeDialer) directDialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.directDialer(network).DialContext(ctx, network, address)
+}
+
+// DialContext connects to address on the named network, through the proxy if one applies,
+// and sends the PROXY protocol header on TCP connections when configured.
+func (d *probeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialContext(ctx, network, address)
+	if err != nil || d.proxyProtocol == "" || !strings.HasPrefix(network, "tcp") {
+		return conn, err
+	}
+
+	// Through a proxy the socket's peer is the proxy, so the real target is announced.
+	dst := d.proxyProtocolDst
+	if proxyURL, _ := d.proxyFor(address); proxyURL != nil && !dst.IsValid() {
+		src := d.proxyProtocolSrc
+		if !src.IsValid() {
+			src = addrPortOf(conn.LocalAddr())
+		}
+		if dst, err = resolveProxyProtocolDst(ctx, address, src.Addr().Unmap().Is4()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if err := writeProxyProtocolHeader(conn, d.proxyProtocol, d.proxyProtocolSrc, dst); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialContext establishes the connection for DialContext.
+func (d *probeDialer) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	direct := d.directDialer(network)
+
+	if !strings.HasPrefix(network, "tcp") {
+		return direct.DialContext(ctx, network, address)
+	}
+
+	proxyURL, err := d.proxyFor(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve proxy: %w", err)
+	}
+	if proxyURL == nil {
+		return direct.DialContext(ctx, network, address)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		socks, err := proxy.FromURL(proxyURL, direct)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOCKS5 proxy: %w", err)
+		}
+		conn, err := socks.(proxy.ContextDialer).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, fmt.Errorf("SOCKS5 proxy %s: %w", proxyURL.Host, err)
+		}
+		return conn, nil
+	default:
+		return d.dialConnect(ctx, direct, proxyURL, address)
+	}
+}
+
+// dialConnect opens a tunnel to address through an HTTP(S) proxy using CONNECT.
+func (d *probeDialer) dialConnect(ctx context.Context, direct *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := direct.DialContext(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %w", proxyAddress, err)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy %s failed: %w", proxyAddress, err)
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT to proxy %s: %w", proxyAddress, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy %s: %w", proxyAddress, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT to %s: %s", proxyAddress, address, resp.Status)
+	}
+
+	// Servers that speak first may already have sent data through the tunnel.
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose first reads are served from a bufio.Reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer before falling through to the connection.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// DialTLS connects to address and performs a TLS handshake with config.
+func (d *probeDialer) DialTLS(network, address string, config *tls.Config) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// describeRoute returns how a request to target would be routed, for display.
+func (d *probeDialer) describeRoute(target *url.URL) string {
+	proxyURL, err := d.proxyForURL(&http.Request{URL: target})
+	if err != nil {
+		return fmt.Sprintf("proxy lookup failed: %v", err)
+	}
+	if proxyURL == nil {
+		return "direct"
+	}
+	return fmt.Sprintf("via %s://%s", proxyURL.Scheme, proxyURL.Host)
+}
+
+// describeSource returns the source binding of outgoing connections, for display.
+func (d *probeDialer) describeSource() string {
+	var parts []string
+	if d.bindIP != nil {
+		parts = append(parts, "address "+d.bindIP.String())
+	}
+	if d.iface != "" {
+		parts = append(parts, "interface "+d.iface)
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// Exit codes returned by mmdebug, so scripts can tell failures apart. They are
+// documented in the README and must not be renumbered.
+const (
+	exitOK              = 0
+	exitProbeFailed     = 1 // the probe failed for a reason without a dedicated code
+	exitUsage           = 2 // invalid flags or missing arguments
+	exitDNS             = 3 // the host name could not be resolved
+	exitRefused         = 4 // the connection was refused
+	exitTimeout         = 5 // the connection or probe timed out
+	exitTLSVerify       = 6 // the server certificate failed verification
+	exitSTARTTLSRefused = 7 // the server declined the STARTTLS upgrade
+	exitSystemCheck     = 8 // a system or Mattermost process check failed
+	exitUnsupported     = 9 // the mode is not available on this platform
+)
+
+var (
+	// errUnsupportedPlatform is wrapped by every stub for a Linux-only feature.
+	errUnsupportedPlatform = fmt.Errorf("only supported on Linux, current OS: %s", runtime.GOOS)
+
+	// errSTARTTLSRefused is wrapped when a server declines the STARTTLS upgrade.
+	errSTARTTLSRefused = errors.New("STARTTLS refused")
+
+	// errBindFamilyMismatch is wrapped when -bind is IPv4 and the destination IPv6, or
+	// the reverse. It is a usage error, not a failed probe.
+	errBindFamilyMismatch = errors.New("bind address family does not match destination")
+)
+
+// exitCode maps err to one of the documented exit codes, or returns fallback when
+// the error has no dedicated code.
+func exitCode(err error, fallback int) int {
+	if err == nil {
+		return fallback
+	}
+
+	if errors.Is(err, errUnsupportedPlatform) {
+		return exitUnsupported
+	}
+	if errors.Is(err, errSTARTTLSRefused) {
+		return exitSTARTTLSRefused
+	}
+	if errors.Is(err, errBindFamilyMismatch) {
+		return exitUsage
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return exitTLSVerify
+	}
+
+	switch classifyConnError(err).class {
+	case connErrDNSNotFound, connErrDNSTemporary:
+		return exitDNS
+	case connErrRefused:
+		return exitRefused
+	case connErrTimeout:
+		return exitTimeout
+	}
+
+	return fallback
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	unknownAuthority := &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}
+
+	tests := []struct {
+		name     string
+		err      error
+		fallback int
+		want     int
+	}{
+		{name: "nil", err: nil, fallback: exitSystemCheck, want: exitSystemCheck},
+		{
+			name:     "dns not found",
+			err:      fmt.Errorf("failed to connect: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "db.internal", IsNotFound: true}}),
+			fallback: exitProbeFailed,
+			want:     exitDNS,
+		},
+		{
+			name:     "dns temporary",
+			err:      fmt.Errorf("failed to connect: %w", &net.DNSError{Name: "db.internal", IsTemporary: true}),
+			fallback: exitProbeFailed,
+			want:     exitDNS,
+		},
+		{name: "refused", err: fmt.Errorf("failed to connect: %w", dialError(syscall.ECONNREFUSED)), fallback: exitProbeFailed, want: exitRefused},
+		{name: "errno timeout", err: fmt.Errorf("failed to connect: %w", dialError(syscall.ETIMEDOUT)), fallback: exitProbeFailed, want: exitTimeout},
+		{name: "net.Error timeout", err: fmt.Errorf("handshake: %w", timeoutError{}), fallback: exitProbeFailed, want: exitTimeout},
+		{name: "unknown authority", err: fmt.Errorf("TLS handshake failed: %w", unknownAuthority), fallback: exitProbeFailed, want: exitTLSVerify},
+		{name: "bare unknown authority", err: x509.UnknownAuthorityError{}, fallback: exitProbeFailed, want: exitTLSVerify},
+		{name: "hostname mismatch", err: fmt.Errorf("TLS handshake failed: %w", x509.HostnameError{Host: "chat.example.com"}), fallback: exitProbeFailed, want: exitTLSVerify},
+		{name: "expired", err: fmt.Errorf("TLS handshake failed: %w", x509.CertificateInvalidError{Reason: x509.Expired}), fallback: exitProbeFailed, want: exitTLSVerify},
+		{name: "starttls refused", err: fmt.Errorf("%w: LDAP resultCode 2", errSTARTTLSRefused), fallback: exitProbeFailed, want: exitSTARTTLSRefused},
+		{name: "bind family mismatch", err: fmt.Errorf("%w: -bind ::1 is IPv6, 192.0.2.10 is IPv4", errBindFamilyMismatch), fallback: exitProbeFailed, want: exitUsage},
+		{name: "unsupported platform", err: fmt.Errorf("ulimits are %w", errUnsupportedPlatform), fallback: exitSystemCheck, want: exitUnsupported},
+		{name: "unclassified errno", err: dialError(syscall.EHOSTUNREACH), fallback: exitProbeFailed, want: exitProbeFailed},
+		{name: "plain error", err: errors.New("unexpected status 502"), fallback: exitProbeFailed, want: exitProbeFailed},
+		{name: "plain error in a system mode", err: errors.New("mattermost process not found"), fallback: exitSystemCheck, want: exitSystemCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err, tt.fallback); got != tt.want {
+				t.Errorf("exitCode(%v, %d) = %d, want %d", tt.err, tt.fallback, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/sys/unix"
+)
+
+// fdInfo is the breakdown of a process's open file descriptors.
+type fdInfo struct {
+	pid        int
+	total      int
+	sockets    int
+	files      int
+	pipes      int
+	anonInodes int
+	other      int
+	softLimit  uint64
+	hardLimit  uint64
+}
+
+// usage returns the open descriptors as a percentage of the soft nofile limit.
+func (f *fdInfo) usage() float64 {
+	if f.softLimit == 0 || f.softLimit == unix.RLIM_INFINITY {
+		return 0
+	}
+	return float64(f.total) * 100 / float64(f.softLimit)
+}
+
+// GetMattermostFDs counts the entries of /proc/<pid>/fd of the Mattermost process by
+// the type their link points to, and reads the process's RLIMIT_NOFILE.
+func GetMattermostFDs(selector *processSelector) (*fdInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := "/proc/" + strconv.Itoa(proc.PID) + "/fd"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file descriptors of PID %d (run as the Mattermost user or root): %w", proc.PID, err)
+	}
+
+	info := &fdInfo{pid: proc.PID}
+	for _, entry := range entries {
+		target, err := os.Readlink(dir + "/" + entry.Name())
+		if err != nil {
+			// The descriptor was closed between listing and reading it.
+			continue
+		}
+
+		info.total++
+		switch {
+		case strings.HasPrefix(target, "socket:"):
+			info.sockets++
+		case strings.HasPrefix(target, "pipe:"):
+			info.pipes++
+		case strings.HasPrefix(target, "anon_inode:"):
+			info.anonInodes++
+		case strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "/dev/"):
+			info.files++
+		default:
+			info.other++
+		}
+	}
+
+	limits, err := readProcessLimits(proc.PID)
+	if err != nil {
+		return nil, err
+	}
+	if values, ok := limits[ulimitProcNames[unix.RLIMIT_NOFILE]]; ok {
+		info.softLimit, info.hardLimit = values[0], values[1]
+	}
+
+	return info, nil
+}
+
+// PrintMattermostFDs prints the file descriptor breakdown of the Mattermost process.
+// It reports whether usage of the soft nofile limit stays below warnPercent.
+func PrintMattermostFDs(selector *processSelector, warnPercent float64) (bool, error) {
+	info, err := GetMattermostFDs(selector)
+	if err != nil {
+		return false, err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Type", "Count"})
+	t.AppendRow(table.Row{"Sockets", info.sockets})
+	t.AppendRow(table.Row{"Regular files", info.files})
+	t.AppendRow(table.Row{"Pipes", info.pipes})
+	t.AppendRow(table.Row{"Anon inodes", info.anonInodes})
+	t.AppendRow(table.Row{"Other (devices)", info.other})
+	t.AppendFooter(table.Row{"Total", info.total})
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Mattermost File Descriptors (PID %d):", info.pid))
+	t.Render()
+
+	usage := info.usage()
+	ok := usage < warnPercent
+	color := text.Colors{text.Bold, text.FgGreen}
+	if !ok {
+		color = text.Colors{text.Bold, text.FgRed}
+	}
+	fmt.Printf("%s\n", color.Sprintf("Open files: %d of %s (%.1f%%, warning at %.0f%%)",
+		info.total, formatUlimitValue(info.softLimit), usage, warnPercent))
+	fmt.Printf("  Hard Limit: %s\n", formatUlimitValue(info.hardLimit))
+
+	return ok, nil
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// fdInfo is the breakdown of a process's open file descriptors.
+type fdInfo struct {
+	pid        int
+	total      int
+	sockets    int
+	files      int
+	pipes      int
+	anonInodes int
+	other      int
+	softLimit  uint64
+	hardLimit  uint64
+}
+
+// usage returns the open descriptors as a percentage of the soft nofile limit.
+func (f *fdInfo) usage() float64 {
+	if f.softLimit == 0 {
+		return 0
+	}
+	return float64(f.total) * 100 / float64(f.softLimit)
+}
+
+// GetMattermostFDs is not available outside Linux, where /proc is used.
+func GetMattermostFDs(selector *processSelector) (*fdInfo, error) {
+	return nil, fmt.Errorf("counting file descriptors is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostFDs is not available outside Linux, where /proc is used.
+func PrintMattermostFDs(selector *processSelector, warnPercent float64) (bool, error) {
+	return false, fmt.Errorf("counting file descriptors is %w", errUnsupportedPlatform)
+}
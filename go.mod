@@ -6,11 +6,12 @@ require github.com/prometheus/procfs v0.16.1
 
 require (
 	github.com/jedib0t/go-pretty/v6 v6.6.7
+	golang.org/x/net v0.39.0
 	golang.org/x/sys v0.32.0
 )
 
 require (
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/text v0.22.0 // indirect
+	golang.org/x/text v0.24.0 // indirect
 )
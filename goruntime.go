@@ -0,0 +1,299 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"go/version"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// goRuntimeEnvNames are the environment variables that size the Go runtime of the
+// server against the machine or container it runs in.
+var goRuntimeEnvNames = []string{"GOMAXPROCS", "GOMEMLIMIT", "GODEBUG"}
+
+// isGoRuntimeEnv reports whether name is one of goRuntimeEnvNames.
+func isGoRuntimeEnv(name string) bool {
+	for _, n := range goRuntimeEnvNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// goRuntimeCheck compares one Go runtime setting of the Mattermost process with the
+// limits of its cgroup.
+type goRuntimeCheck struct {
+	setting   string
+	env       string
+	effective string
+	limit     string
+	ok        bool
+	info      bool
+	note      string
+}
+
+// goRuntimeLimits is the result of GetMattermostGoRuntimeLimits.
+type goRuntimeLimits struct {
+	pid       int
+	goVersion string
+	cgroup    string
+	cgroupErr error
+	checks    []goRuntimeCheck
+}
+
+// problems returns the settings that do not match the cgroup limits.
+func (l *goRuntimeLimits) problems() []string {
+	var problems []string
+	for _, check := range l.checks {
+		if !check.info && !check.ok {
+			problems = append(problems, check.setting)
+		}
+	}
+	return problems
+}
+
+// summary returns the effective settings and their limits in one line.
+func (l *goRuntimeLimits) summary() string {
+	var parts []string
+	for _, check := range l.checks {
+		if !check.info {
+			parts = append(parts, fmt.Sprintf("%s %s (limit %s)", check.setting, check.effective, check.limit))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// godebugValue returns the value of key in a comma-separated GODEBUG list. As in the
+// runtime, the last occurrence wins.
+func godebugValue(godebug, key string) (string, bool) {
+	value, found := "", false
+	for _, setting := range strings.Split(godebug, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(setting), "="); ok && k == key {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// parseGoMemLimit parses a GOMEMLIMIT value: a byte count with an optional B, KiB,
+// MiB, GiB or TiB suffix, or "off".
+func parseGoMemLimit(s string) (uint64, error) {
+	if s == "off" {
+		return math.MaxInt64, nil
+	}
+	units := []struct {
+		suffix string
+		factor uint64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+	}
+	factor := uint64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, factor = strings.TrimSuffix(s, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid GOMEMLIMIT %q", s)
+	}
+	return n * factor, nil
+}
+
+// GetMattermostGoRuntimeLimits reads GOMAXPROCS, GOMEMLIMIT and GODEBUG from the
+// environment of the Mattermost process and compares what the Go runtime makes of them
+// with the cgroup v2 cpu.max and memory.max that apply to the process.
+func GetMattermostGoRuntimeLimits(selector *processSelector) (*goRuntimeLimits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	environ, err := proc.Environ()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment for PID %d: %w", proc.PID, err)
+	}
+	env := make(map[string]string)
+	for _, e := range environ {
+		name, value, _ := strings.Cut(e, "=")
+		env[name] = value
+	}
+
+	// Without GOMAXPROCS the runtime starts from the CPUs in the process's affinity mask.
+	cpus := runtime.NumCPU()
+	if status, err := proc.NewStatus(); err == nil && len(status.CpusAllowedList) > 0 {
+		cpus = len(status.CpusAllowedList)
+	}
+
+	// Without cgroup v2 the settings are still shown, but there is nothing to compare with.
+	result := &goRuntimeLimits{pid: proc.PID}
+	result.cgroup, result.cgroupErr = processCgroupDir(proc)
+
+	containerAware := false
+	godebug := env["GODEBUG"]
+	if info, err := buildinfo.ReadFile("/proc/" + strconv.Itoa(proc.PID) + "/exe"); err == nil {
+		result.goVersion = info.GoVersion
+		defaultGODEBUG := ""
+		for _, setting := range info.Settings {
+			if setting.Key == "DefaultGODEBUG" {
+				defaultGODEBUG = setting.Value
+			}
+		}
+		containerAware = containerAwareGOMAXPROCS(info.GoVersion, defaultGODEBUG, godebug)
+	}
+
+	var cpuLimit float64
+	var cpuSource string
+	var cpuLimited bool
+	var memLimit uint64
+	var memSource string
+	var memLimited bool
+	limitLabel := "max"
+	if result.cgroupErr == nil {
+		cpuLimit, cpuSource, cpuLimited = cgroupCPULimit(result.cgroup)
+		memLimit, memSource, memLimited = cgroupMemoryLimit(result.cgroup)
+	} else {
+		limitLabel = "unknown"
+	}
+
+	maxprocs := effectiveGOMAXPROCS(env["GOMAXPROCS"], cpus, containerAware, cpuLimit, cpuLimited)
+	cpuCheck := goRuntimeCheck{setting: "GOMAXPROCS", env: env["GOMAXPROCS"], effective: strconv.Itoa(maxprocs), limit: limitLabel, ok: true}
+	if cpuLimited {
+		// The runtime itself never goes below 2 when deriving GOMAXPROCS from cpu.max.
+		cpuCheck.limit = fmt.Sprintf("%.2f CPUs (%s)", cpuLimit, cpuSource)
+		if maxprocs > max(2, int(math.Ceil(cpuLimit))) {
+			cpuCheck.ok = false
+			cpuCheck.note = fmt.Sprintf("Go runs goroutines on %d CPUs in parallel but the cgroup allows %.2f; expect CPU throttling, set GOMAXPROCS=%d",
+				maxprocs, cpuLimit, int(math.Ceil(cpuLimit)))
+		}
+	}
+	result.checks = append(result.checks, cpuCheck)
+
+	memCheck := goRuntimeCheck{setting: "GOMEMLIMIT", env: env["GOMEMLIMIT"], effective: "unlimited", limit: limitLabel, ok: true}
+	// Leave about 10% of memory.max for memory outside the Go heap.
+	suggested := memLimit / 10 * 9 / (1 << 20)
+	if memLimited {
+		memCheck.limit = fmt.Sprintf("%s (%s)", formatBytes(memLimit), memSource)
+	}
+	if value, set := env["GOMEMLIMIT"]; set {
+		goLimit, err := parseGoMemLimit(value)
+		switch {
+		case err != nil:
+			memCheck.effective = "invalid"
+			memCheck.ok = false
+			memCheck.note = err.Error()
+		case goLimit != math.MaxInt64:
+			memCheck.effective = formatBytes(goLimit)
+			if memLimited && goLimit >= memLimit {
+				memCheck.ok = false
+				memCheck.note = fmt.Sprintf("GOMEMLIMIT is not below memory.max, the process is OOM killed before the GC reacts; set GOMEMLIMIT=%dMiB", suggested)
+			}
+		}
+	}
+	if memLimited && memCheck.ok && memCheck.effective == "unlimited" {
+		memCheck.ok = false
+		memCheck.note = fmt.Sprintf("no GOMEMLIMIT below the cgroup memory.max of %s, the heap can grow until the OOM kill; set GOMEMLIMIT=%dMiB",
+			formatBytes(memLimit), suggested)
+	}
+	result.checks = append(result.checks, memCheck)
+
+	godebugCheck := goRuntimeCheck{setting: "GODEBUG", env: godebug, info: true}
+	if result.goVersion != "" && version.Compare(result.goVersion, "go1.25") >= 0 {
+		godebugCheck.effective = "containermaxprocs=0"
+		if containerAware {
+			godebugCheck.effective = "containermaxprocs=1"
+		}
+	}
+	result.checks = append(result.checks, godebugCheck)
+
+	return result, nil
+}
+
+// containerAwareGOMAXPROCS reports whether a binary built with goVersion derives its
+// default GOMAXPROCS from cpu.max. Since Go 1.25 it does, unless containermaxprocs=0,
+// which is also the default for main modules declaring an older go version.
+func containerAwareGOMAXPROCS(goVersion, defaultGODEBUG, godebug string) bool {
+	if version.Compare(goVersion, "go1.25") < 0 {
+		return false
+	}
+	v, ok := godebugValue(defaultGODEBUG+","+godebug, "containermaxprocs")
+	return !ok || v != "0"
+}
+
+// effectiveGOMAXPROCS returns the GOMAXPROCS the runtime uses: the environment variable
+// when it is a positive number, otherwise the CPU count, capped by cpu.max on Go 1.25+.
+func effectiveGOMAXPROCS(env string, cpus int, containerAware bool, limit float64, limited bool) int {
+	if n, err := strconv.Atoi(env); err == nil && n > 0 {
+		return n
+	}
+	if containerAware && limited {
+		return min(cpus, max(2, int(math.Ceil(limit))))
+	}
+	return cpus
+}
+
+// PrintMattermostGoRuntimeLimits prints the Go runtime settings of the Mattermost process
+// next to its cgroup limits. It returns false if any of them mismatch.
+func PrintMattermostGoRuntimeLimits(selector *processSelector) (bool, error) {
+	limits, err := GetMattermostGoRuntimeLimits(selector)
+	if err != nil {
+		return false, err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Setting", "Environment", "Effective", "Cgroup Limit", "Status"})
+
+	allOK := true
+	var notes []string
+	for _, check := range limits.checks {
+		env := check.env
+		if env == "" {
+			env = text.Colors{text.Faint}.Sprint("(not set)")
+		}
+		status := text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
+		switch {
+		case check.info:
+			status = ""
+		case !check.ok:
+			status = text.Colors{text.Bold, text.FgYellow}.Sprint("WARN")
+			allOK = false
+			notes = append(notes, check.setting+": "+check.note)
+		}
+		t.AppendRow(table.Row{check.setting, env, check.effective, check.limit, status})
+	}
+
+	goVersion := limits.goVersion
+	if goVersion == "" {
+		goVersion = "Go version unknown"
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Go Runtime vs Cgroup Limits (PID %d, %s):", limits.pid, goVersion))
+	t.Render()
+	if limits.cgroupErr != nil {
+		fmt.Printf("  Cgroup: %s\n", text.Colors{text.Faint}.Sprintf("unknown (%v)", limits.cgroupErr))
+	} else {
+		fmt.Printf("  Cgroup: %s\n", limits.cgroup)
+	}
+	for _, note := range notes {
+		fmt.Printf("  %s\n", text.Colors{text.FgYellow}.Sprint(note))
+	}
+
+	return allOK, nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// goRuntimeLimits compares the Go runtime settings of the Mattermost process with its
+// cgroup limits.
+type goRuntimeLimits struct {
+	pid int
+}
+
+// problems returns the settings that do not match the cgroup limits.
+func (l *goRuntimeLimits) problems() []string {
+	return nil
+}
+
+// summary returns the effective settings and their limits in one line.
+func (l *goRuntimeLimits) summary() string {
+	return ""
+}
+
+// GetMattermostGoRuntimeLimits is not available outside Linux, where /proc and cgroup v2 are used.
+func GetMattermostGoRuntimeLimits(selector *processSelector) (*goRuntimeLimits, error) {
+	return nil, fmt.Errorf("comparing Go runtime settings with cgroup limits is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostGoRuntimeLimits is not available outside Linux, where /proc and cgroup v2 are used.
+func PrintMattermostGoRuntimeLimits(selector *processSelector) (bool, error) {
+	return false, fmt.Errorf("comparing Go runtime settings with cgroup limits is %w", errUnsupportedPlatform)
+}
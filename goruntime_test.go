@@ -0,0 +1,131 @@
+//go:build linux
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseGoMemLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{value: "1073741824", want: 1 << 30},
+		{value: "512B", want: 512},
+		{value: "64KiB", want: 64 << 10},
+		{value: "1800MiB", want: 1800 << 20},
+		{value: "4GiB", want: 4 << 30},
+		{value: "1TiB", want: 1 << 40},
+		{value: "off", want: math.MaxInt64},
+		{value: "", wantErr: true},
+		{value: "4GB", wantErr: true},
+		{value: "1.5GiB", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "MiB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseGoMemLimit(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseGoMemLimit(%q) = %d, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGoMemLimit(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseGoMemLimit(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGodebugValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		godebug   string
+		key       string
+		want      string
+		wantFound bool
+	}{
+		{name: "empty", godebug: "", key: "containermaxprocs"},
+		{name: "single", godebug: "containermaxprocs=0", key: "containermaxprocs", want: "0", wantFound: true},
+		{name: "among others", godebug: "madvdontneed=1, containermaxprocs=1,gctrace=1", key: "containermaxprocs", want: "1", wantFound: true},
+		{name: "last wins", godebug: "containermaxprocs=0,containermaxprocs=1", key: "containermaxprocs", want: "1", wantFound: true},
+		{name: "prefix is not a match", godebug: "containermaxprocsx=0", key: "containermaxprocs"},
+		{name: "no value", godebug: "containermaxprocs", key: "containermaxprocs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := godebugValue(tt.godebug, tt.key)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("godebugValue(%q, %q) = %q %v, want %q %v", tt.godebug, tt.key, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestContainerAwareGOMAXPROCS(t *testing.T) {
+	tests := []struct {
+		name           string
+		goVersion      string
+		defaultGODEBUG string
+		godebug        string
+		want           bool
+	}{
+		{name: "go1.24", goVersion: "go1.24.4"},
+		{name: "go1.25", goVersion: "go1.25.0", want: true},
+		{name: "go1.26 release candidate", goVersion: "go1.26rc1", want: true},
+		{name: "unknown version", goVersion: ""},
+		{name: "older go.mod default", goVersion: "go1.25.1", defaultGODEBUG: "containermaxprocs=0,updatemaxprocs=0"},
+		{name: "disabled in environment", goVersion: "go1.25.1", godebug: "containermaxprocs=0"},
+		{name: "environment overrides default", goVersion: "go1.25.1", defaultGODEBUG: "containermaxprocs=0", godebug: "containermaxprocs=1", want: true},
+		{name: "environment cannot enable before go1.25", goVersion: "go1.24.4", godebug: "containermaxprocs=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerAwareGOMAXPROCS(tt.goVersion, tt.defaultGODEBUG, tt.godebug); got != tt.want {
+				t.Errorf("containerAwareGOMAXPROCS = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveGOMAXPROCS(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            string
+		cpus           int
+		containerAware bool
+		limit          float64
+		limited        bool
+		want           int
+	}{
+		{name: "host sized", cpus: 64, want: 64},
+		{name: "cpu.max ignored before go1.25", cpus: 64, limit: 4, limited: true, want: 64},
+		{name: "cpu.max rounded up", cpus: 64, containerAware: true, limit: 2.5, limited: true, want: 3},
+		{name: "never below 2", cpus: 64, containerAware: true, limit: 0.5, limited: true, want: 2},
+		{name: "capped by cpus", cpus: 2, containerAware: true, limit: 8, limited: true, want: 2},
+		{name: "unlimited", cpus: 16, containerAware: true, want: 16},
+		{name: "environment wins", env: "12", cpus: 64, containerAware: true, limit: 4, limited: true, want: 12},
+		{name: "invalid environment", env: "many", cpus: 8, want: 8},
+		{name: "zero environment", env: "0", cpus: 8, want: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := effectiveGOMAXPROCS(tt.env, tt.cpus, tt.containerAware, tt.limit, tt.limited)
+			if got != tt.want {
+				t.Errorf("effectiveGOMAXPROCS = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	httpMaxRedirects    = 10
+	httpMaxBodySize     = 1 << 20
+	httpBodyExcerptSize = 512
+
+	mattermostPingPath = "/api/v4/system/ping?get_server_status=true"
+)
+
+// httpKeyHeaders are the response headers shown in http mode, in display order.
+var httpKeyHeaders = []string{
+	"Server",
+	"Content-Type",
+	"Content-Length",
+	"Cache-Control",
+	"Strict-Transport-Security",
+	"X-Frame-Options",
+	"X-Request-Id",
+	"X-Version-Id",
+	"X-Cluster-Id",
+}
+
+// httpHop is a single response in a redirect chain.
+type httpHop struct {
+	url        string
+	statusCode int
+	location   string
+}
+
+// httpTimings holds the phases of the last request in a redirect chain.
+type httpTimings struct {
+	dns          time.Duration
+	connect      time.Duration
+	tlsHandshake time.Duration
+	firstByte    time.Duration
+	total        time.Duration
+}
+
+// httpTestResult contains information about an HTTP probe.
+type httpTestResult struct {
+	success    bool
+	url        string
+	chain      []httpHop
+	statusCode int
+	status     string
+	proto      string
+	headers    http.Header
+	body       []byte
+	tls        *tls.ConnectionState
+	timings    httpTimings
+	err        error
+}
+
+// mattermostBaseURL builds the URL to probe from -url or, failing that, from host and port.
+func mattermostBaseURL(rawURL, host string, port int) string {
+	if rawURL != "" {
+		return strings.TrimSuffix(rawURL, "/")
+	}
+
+	scheme := "https"
+	if port == 80 {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// testHTTPRequest performs a GET request to target, following redirects and recording the chain.
+// The TLS options mirror the tls modes: a custom SNI and optionally skipping verification.
+// Proxies are applied by the transport, exactly as Mattermost's own HTTP client does.
+func testHTTPRequest(target, sni string, insecure bool, dialer *probeDialer) *httpTestResult {
+	result := &httpTestResult{
+		url: target,
+	}
+
+	transport := &http.Transport{
+		Proxy:       dialer.proxyForURL,
+		DialContext: dialer.directDialContext,
+		TLSClientConfig: &tls.Config{
+			ServerName:         sni,
+			InsecureSkipVerify: insecure,
+		},
+		TLSHandshakeTimeout: dialer.timeout,
+		ForceAttemptHTTP2:   true,
+	}
+	// The PROXY header must be the first bytes the target sees, so with -proxy-protocol
+	// the dialer tunnels through the proxy itself instead of the transport.
+	if dialer.proxyProtocol != "" {
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   dialer.timeout,
+	}
+
+	var start, dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			start = time.Now()
+			result.timings = httpTimings{}
+		},
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { result.timings.dns = time.Since(dnsStart) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { result.timings.connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			result.timings.tlsHandshake = time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() { result.timings.firstByte = time.Since(start) },
+	}
+
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		result.err = fmt.Errorf("invalid URL: %w", err)
+		return result
+	}
+	req.Header.Set("User-Agent", "mmdebug")
+
+	// Record every hop, including redirects, as the responses come in.
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if resp := next.Response; resp != nil {
+			result.chain = append(result.chain, httpHop{
+				url:        resp.Request.URL.String(),
+				statusCode: resp.StatusCode,
+				location:   resp.Header.Get("Location"),
+			})
+		}
+		if len(via) >= httpMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", httpMaxRedirects)
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.err = fmt.Errorf("HTTP request failed: %w", err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.body, err = io.ReadAll(io.LimitReader(resp.Body, httpMaxBodySize))
+	if err != nil {
+		result.err = fmt.Errorf("failed to read response body: %w", err)
+		return result
+	}
+	if start.IsZero() {
+		start = time.Now()
+	}
+	result.timings.total = time.Since(start)
+
+	result.url = resp.Request.URL.String()
+	result.chain = append(result.chain, httpHop{url: result.url, statusCode: resp.StatusCode})
+	result.statusCode = resp.StatusCode
+	result.status = resp.Status
+	result.proto = resp.Proto
+	result.headers = resp.Header
+	result.tls = resp.TLS
+	result.success = resp.StatusCode < 400
+	if !result.success {
+		result.err = fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	return result
+}
+
+// printHTTPResult prints the status, redirect chain, timings, key headers and a body excerpt.
+func printHTTPResult(result *httpTestResult) {
+	if result.statusCode == 0 {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("HTTP request to %s failed: %v", result.url, result.err))
+		printLikelyCause(result.err)
+		return
+	}
+
+	color := text.Colors{text.Bold, text.FgGreen}
+	if !result.success {
+		color = text.Colors{text.Bold, text.FgRed}
+	}
+	fmt.Printf("%s\n", color.Sprintf("HTTP request to %s returned %s", result.url, result.status))
+	fmt.Printf("  Protocol: %s\n", result.proto)
+	if result.tls != nil {
+		fmt.Printf("  TLS Version: %s\n", tlsVersionString(result.tls.Version))
+		fmt.Printf("  Cipher Suite: %s\n", cipherSuiteString(result.tls.CipherSuite))
+	}
+
+	if len(result.chain) > 1 {
+		fmt.Printf("  Redirect Chain:\n")
+		for i, hop := range result.chain {
+			if hop.location != "" {
+				fmt.Printf("    %d. %d %s -> %s\n", i+1, hop.statusCode, hop.url, hop.location)
+			} else {
+				fmt.Printf("    %d. %d %s\n", i+1, hop.statusCode, hop.url)
+			}
+		}
+	}
+
+	fmt.Printf("  Timings: dns=%v connect=%v tls=%v first-byte=%v total=%v\n",
+		result.timings.dns, result.timings.connect, result.timings.tlsHandshake, result.timings.firstByte, result.timings.total)
+
+	for _, name := range httpKeyHeaders {
+		if value := result.headers.Get(name); value != "" {
+			fmt.Printf("  %s: %s\n", name, value)
+		}
+	}
+
+	if len(result.body) > 0 {
+		fmt.Printf("  Body: %s\n", bodyExcerpt(result.body))
+	}
+}
+
+// bodyExcerpt truncates a response body, flattens it onto one line and masks non-printable bytes.
+func bodyExcerpt(body []byte) string {
+	truncated := len(body) > httpBodyExcerptSize
+	if truncated {
+		body = body[:httpBodyExcerptSize]
+	}
+
+	excerpt := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case !unicode.IsPrint(r):
+			return '.'
+		default:
+			return r
+		}
+	}, string(body))
+
+	if truncated {
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+// GetMattermostPing decodes the server status returned by the Mattermost ping endpoint.
+func GetMattermostPing(result *httpTestResult) (map[string]any, error) {
+	if result.statusCode == 0 {
+		return nil, result.err
+	}
+
+	var status map[string]any
+	if err := json.Unmarshal(result.body, &status); err != nil {
+		return nil, fmt.Errorf("ping response is not valid JSON: %w", err)
+	}
+	return status, nil
+}
+
+// unhealthyPingFields returns the ping status fields that are not OK, as key=value.
+func unhealthyPingFields(status map[string]any) []string {
+	var unhealthy []string
+	for key, value := range status {
+		if strings.HasSuffix(strings.ToLower(key), "status") && !strings.EqualFold(fmt.Sprint(value), "OK") {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	sort.Strings(unhealthy)
+	return unhealthy
+}
+
+// PrintMattermostPing renders the ping endpoint's server status as a table.
+// It reports whether the server, database and filestore are all healthy.
+func PrintMattermostPing(result *httpTestResult) (bool, error) {
+	status, err := GetMattermostPing(result)
+	if err != nil {
+		return false, err
+	}
+
+	keys := make([]string, 0, len(status))
+	for key := range status {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Field", "Value", "Status"})
+
+	healthy := true
+	for _, key := range keys {
+		value := fmt.Sprint(status[key])
+		if !strings.HasSuffix(strings.ToLower(key), "status") {
+			t.AppendRow(table.Row{key, value, ""})
+			continue
+		}
+
+		state := text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
+		colored := text.Colors{text.Bold, text.FgRed}.Sprint(value)
+		if strings.EqualFold(value, "OK") {
+			state = text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
+			colored = text.Colors{text.Bold, text.FgGreen}.Sprint(value)
+		} else {
+			healthy = false
+		}
+		t.AppendRow(table.Row{key, colored, state})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprint("Mattermost Server Status:"))
+	t.Render()
+
+	return healthy, nil
+}
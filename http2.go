@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// HTTP/2 connection preface, frame types and settings (RFC 9113).
+const (
+	http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2FrameHeader   = 9
+
+	http2FrameSettings = 0x4
+	http2FrameGoAway   = 0x7
+	http2FlagAck       = 0x1
+)
+
+// http2SettingNames maps SETTINGS identifiers to their names.
+var http2SettingNames = map[uint16]string{
+	0x1: "HEADER_TABLE_SIZE",
+	0x2: "ENABLE_PUSH",
+	0x3: "MAX_CONCURRENT_STREAMS",
+	0x4: "INITIAL_WINDOW_SIZE",
+	0x5: "MAX_FRAME_SIZE",
+	0x6: "MAX_HEADER_LIST_SIZE",
+	0x8: "ENABLE_CONNECT_PROTOCOL",
+	0x9: "NO_RFC7540_PRIORITIES",
+}
+
+// http2Setting is a single SETTINGS parameter sent by the server.
+type http2Setting struct {
+	id    uint16
+	value uint32
+}
+
+// http2TestResult contains information about an HTTP/2 negotiation test.
+type http2TestResult struct {
+	success            bool
+	server             string
+	negotiatedProtocol string
+	version            uint16
+	settings           []http2Setting
+	settingsAcked      bool
+	rtt                time.Duration
+	err                error
+}
+
+// testHTTP2 negotiates h2 via ALPN and completes the SETTINGS exchange: the server's
+// SETTINGS frame is acknowledged and the server must acknowledge ours in return.
+func testHTTP2(host string, port int, sni string, insecure bool, dialer *probeDialer) *http2TestResult {
+	result := &http2TestResult{
+		server: net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+
+	serverName := host
+	if sni != "" {
+		serverName = sni
+	}
+
+	conn, err := dialer.DialTLS("tcp", result.server, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		result.err = fmt.Errorf("TLS handshake failed: %w", err)
+		return result
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	result.version = state.Version
+	result.negotiatedProtocol = state.NegotiatedProtocol
+	if state.NegotiatedProtocol != "h2" {
+		result.err = fmt.Errorf("server did not negotiate h2 (ALPN: %s)", alpnString(state.NegotiatedProtocol))
+		return result
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(dialer.timeout)); err != nil {
+		result.err = fmt.Errorf("failed to set deadline: %w", err)
+		return result
+	}
+
+	start := time.Now()
+	preface := append([]byte(http2ClientPreface), http2Frame(http2FrameSettings, 0, nil)...)
+	if _, err := conn.Write(preface); err != nil {
+		result.err = fmt.Errorf("failed to send connection preface: %w", err)
+		return result
+	}
+
+	reader := bufio.NewReader(conn)
+	gotSettings := false
+	for !gotSettings || !result.settingsAcked {
+		typ, flags, payload, err := readHTTP2Frame(reader)
+		if err != nil {
+			result.err = fmt.Errorf("SETTINGS exchange failed: %w", err)
+			return result
+		}
+
+		switch typ {
+		case http2FrameSettings:
+			if flags&http2FlagAck != 0 {
+				result.settingsAcked = true
+				result.rtt = time.Since(start)
+				continue
+			}
+			for i := 0; i+6 <= len(payload); i += 6 {
+				result.settings = append(result.settings, http2Setting{
+					id:    binary.BigEndian.Uint16(payload[i : i+2]),
+					value: binary.BigEndian.Uint32(payload[i+2 : i+6]),
+				})
+			}
+			gotSettings = true
+			if _, err := conn.Write(http2Frame(http2FrameSettings, http2FlagAck, nil)); err != nil {
+				result.err = fmt.Errorf("failed to acknowledge SETTINGS: %w", err)
+				return result
+			}
+		case http2FrameGoAway:
+			code := uint32(0)
+			if len(payload) >= 8 {
+				code = binary.BigEndian.Uint32(payload[4:8])
+			}
+			result.err = fmt.Errorf("server sent GOAWAY (error code 0x%x)", code)
+			return result
+		}
+	}
+
+	// Say goodbye cleanly: last stream 0, NO_ERROR.
+	_, _ = conn.Write(http2Frame(http2FrameGoAway, 0, make([]byte, 8)))
+
+	result.success = true
+	return result
+}
+
+// http2Frame builds a frame on stream 0.
+func http2Frame(typ, flags byte, payload []byte) []byte {
+	frame := make([]byte, http2FrameHeader, http2FrameHeader+len(payload))
+	frame[0] = byte(len(payload) >> 16)
+	frame[1] = byte(len(payload) >> 8)
+	frame[2] = byte(len(payload))
+	frame[3] = typ
+	frame[4] = flags
+	return append(frame, payload...)
+}
+
+// readHTTP2Frame reads one frame and returns its type, flags and payload.
+func readHTTP2Frame(r io.Reader) (byte, byte, []byte, error) {
+	var header [http2FrameHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[3], header[4], payload, nil
+}
+
+// alpnString returns the negotiated ALPN protocol, or "none" if nothing was negotiated.
+func alpnString(protocol string) string {
+	if protocol == "" {
+		return "none"
+	}
+	return protocol
+}
+
+// printHTTP2Result prints a colorized HTTP/2 test result with the server's SETTINGS.
+func printHTTP2Result(result *http2TestResult) {
+	if !result.success {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("HTTP/2 negotiation with %s failed: %v", result.server, result.err))
+		printLikelyCause(result.err)
+		return
+	}
+
+	fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("HTTP/2 negotiation with %s successful", result.server))
+	fmt.Printf("  TLS Version: %s\n", tlsVersionString(result.version))
+	fmt.Printf("  ALPN Protocol: %s\n", result.negotiatedProtocol)
+	fmt.Printf("  SETTINGS Acknowledged: %v (RTT %v)\n", result.settingsAcked, result.rtt)
+	for _, setting := range result.settings {
+		name, ok := http2SettingNames[setting.id]
+		if !ok {
+			name = fmt.Sprintf("0x%x", setting.id)
+		}
+		fmt.Printf("  %s: %d\n", name, setting.value)
+	}
+}
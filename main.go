@@ -3,7 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,93 +17,426 @@ func main() {
 		host    = flag.String("host", "", "Host to connect to")
 		port    = flag.Int("port", 443, "Port to connect to")
 		timeout = flag.Duration("timeout", 10*time.Second, "Connection timeout")
-		mode    = flag.String("mode", "tcp", "Test mode: tcp, tls, tls-insecure, tls-sni, tls-postgres, tls-ldap, ulimits, mm-env, sysctl")
+		mode    = flag.String("mode", "tcp", "Test mode: tcp, udp, udp-responder, stun, turn, http, http2, websocket, route, batch, tls, tls-insecure, tls-sni, tls-postgres, tls-ldap, ulimits, mm-env, mm-proxy, mm-fds, mm-proc, mm-plugins, mm-version, cgroup, pressure, sysctl")
 		sni     = flag.String("sni", "", "Custom SNI for TLS connections")
+		alpn    = flag.String("alpn", "", "Comma-separated ALPN protocols to offer in TLS modes, e.g. h2,http/1.1")
+		count   = flag.Int("count", 3, "Number of probes to send in udp mode")
+
+		transport       = flag.String("transport", "udp", "Transport for stun and turn modes: udp, tcp, tls")
+		iceHostOverride = flag.String("ice-host-override", "", "Expected reflexive address (Calls ICE host override) for stun mode")
+		turnUser        = flag.String("turn-user", "", "Username for turn mode")
+		turnPassword    = flag.String("turn-password", "", "Password for turn mode")
+		turnSecret      = flag.String("turn-secret", "", "Static auth secret to derive turn credentials from, instead of -turn-password")
+
+		rawURL     = flag.String("url", "", "URL to request in http mode (default: https://<host>:<port>)")
+		insecure   = flag.Bool("insecure", false, "Skip certificate verification in http, http2 and websocket modes")
+		mattermost = flag.Bool("mattermost", false, "Query the Mattermost ping endpoint in http mode")
+		token      = flag.String("token", "", "Mattermost access token for websocket mode")
+		wsDuration = flag.Duration("ws-duration", 30*time.Second, "How long to keep the connection open in websocket mode")
+
+		proxyURL      = flag.String("proxy", "", "Proxy for TCP-based probes: http://, https:// or socks5://[user:pass@]host:port")
+		proxyFromEnv  = flag.Bool("proxy-from-env", false, "Honor HTTPS_PROXY/HTTP_PROXY/NO_PROXY like Mattermost's HTTP client")
+		bindIP        = flag.String("bind", "", "Source IP address for outgoing probe connections")
+		iface         = flag.String("interface", "", "Network interface to send probes from (Linux, SO_BINDTODEVICE)")
+		proxyProto    = flag.String("proxy-protocol", "", "Send a HAProxy PROXY protocol header (v1 or v2) before the handshake in TCP-based probes")
+		proxyProtoSrc = flag.String("proxy-protocol-src", "", "Source ip:port announced in the PROXY header (default: local address)")
+		proxyProtoDst = flag.String("proxy-protocol-dst", "", "Destination ip:port announced in the PROXY header (default: remote address)")
+		targets       = flag.String("targets", "", "Extra comma-separated [name=]URL or host:port targets for mm-proxy mode")
+
+		pid         = flag.Int("pid", 0, "PID of the Mattermost process for system modes")
+		processName = flag.String("process-name", "", "Regular expression matched against comm, cmdline and exe to find the Mattermost process")
+		cgroup      = flag.String("cgroup", "", "Select the Mattermost process by a substring of its cgroup path, e.g. a container ID or mattermost.service; the comm must be mattermost unless -process-name is given")
+		fdWarn      = flag.Float64("fd-warn", 80, "Warn when the Mattermost process uses this percentage of its nofile limit in mm-fds mode")
+		threadWarn  = flag.Float64("thread-warn", 80, "Warn when the threads of the Mattermost user reach this percentage of its nproc limit in ulimits mode")
+		window      = flag.Duration("pressure-window", 10*time.Second, "How long to sample pressure stall information in pressure mode")
+
+		batchFile = flag.String("file", "", "Target file for batch mode, one probe per line using the same flags as the command line")
+		workers   = flag.Int("workers", 5, "Maximum number of concurrent probes in batch mode")
+		watch     = flag.Duration("watch", 0, "Re-run the check at this interval and print state changes until interrupted, e.g. 5s")
 	)
 
 	flag.Parse()
 
-	if *host == "" && *mode != "ulimits" && *mode != "mm-env" && *mode != "sysctl" {
+	var alpnProtocols []string
+	if *alpn != "" {
+		alpnProtocols = strings.Split(*alpn, ",")
+	}
+
+	if *host == "" && *rawURL != "" {
+		if u, err := url.Parse(*rawURL); err == nil {
+			*host = u.Hostname()
+		}
+	}
+
+	if !flagWasSet("port") && (strings.ToLower(*mode) == "stun" || strings.ToLower(*mode) == "turn") {
+		*port = stunDefaultPort
+		if strings.ToLower(*transport) == "tls" {
+			*port = stunDefaultTLSPort
+		}
+	}
+
+	if *host == "" && modeRequiresHost(*mode) {
 		fmt.Fprintf(os.Stderr, "Error: host is required\n")
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+
+	selector, err := newProcessSelector(*pid, *processName, *cgroup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	dialer, err := newProbeDialer(*proxyURL, *proxyFromEnv, *bindIP, *iface, *timeout)
+	if err == nil && *proxyProto != "" {
+		err = dialer.setProxyProtocol(strings.ToLower(*proxyProto), *proxyProtoSrc, *proxyProtoDst)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if (*proxyURL != "" || *proxyFromEnv) && modeUsesProxy(*mode, *transport) {
+		target := &url.URL{Scheme: "https", Host: net.JoinHostPort(*host, strconv.Itoa(*port))}
+		if strings.ToLower(*mode) == "http" {
+			if u, err := url.Parse(mattermostBaseURL(*rawURL, *host, *port)); err == nil {
+				target = u
+			}
+		}
+		fmt.Printf("Route: %s\n", dialer.describeRoute(target))
+	}
+	if *bindIP != "" || *iface != "" {
+		fmt.Printf("Source: %s\n", dialer.describeSource())
+	}
+
+	if *watch > 0 {
+		target := batchTarget{
+			name:         *host,
+			mode:         strings.ToLower(*mode),
+			host:         *host,
+			port:         *port,
+			sni:          *sni,
+			alpn:         alpnProtocols,
+			count:        *count,
+			transport:    strings.ToLower(*transport),
+			turnUser:     *turnUser,
+			turnPassword: *turnPassword,
+			turnSecret:   *turnSecret,
+			url:          *rawURL,
+			insecure:     *insecure,
+			mattermost:   *mattermost,
+			token:        *token,
+			wsDuration:   *wsDuration,
+		}
+		check, err := newWatchCheck(target.mode, target, dialer, *bindIP, *iface, strings.Split(*targets, ","), *fdWarn, *threadWarn, selector)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+
+		description := target.mode + " check"
+		switch {
+		case target.mode == "route":
+			description += " of " + target.host
+		case modeRequiresHost(target.mode):
+			description += " of " + target.address()
+		}
+		stats := runWatch(description, *watch, check)
+		if stats.failures > 0 {
+			os.Exit(watchExitCode(target.mode))
+		}
+		return
 	}
 
 	switch strings.ToLower(*mode) {
 	case "tcp":
-		err := testTCPConnection(*host, *port, *timeout)
+		err := testTCPConnection(*host, *port, dialer)
 		printTCPResult(*host, *port, err)
+		if runtime.GOOS == "linux" {
+			// Through a proxy the packets to -host leave this machine towards the proxy.
+			routeHost := *host
+			if proxy, err := dialer.proxyFor(net.JoinHostPort(*host, strconv.Itoa(*port))); err == nil && proxy != nil {
+				routeHost = proxy.Hostname()
+				fmt.Printf("Connection goes through proxy %s, showing the route to the proxy\n", proxy.Host)
+			}
+			if routeErr := PrintRoute(routeHost, *bindIP, *iface); routeErr != nil {
+				fmt.Printf("Route lookup failed: %v\n", routeErr)
+			}
+		}
 		if err != nil {
-			os.Exit(1)
+			os.Exit(exitCode(err, exitProbeFailed))
+		}
+
+	case "udp":
+		result := testUDPConnection(*host, *port, *count, dialer)
+		printUDPResult(result, *host, *port)
+		if !result.success() {
+			os.Exit(result.exitCode())
+		}
+
+	case "udp-responder":
+		err := runUDPResponder(*host, *port)
+		if err != nil {
+			fmt.Printf("UDP responder failed: %v\n", err)
+			os.Exit(exitCode(err, exitProbeFailed))
+		}
+
+	case "stun":
+		result := testSTUNBinding(*host, *port, strings.ToLower(*transport), dialer)
+		printSTUNResult(result, *iceHostOverride)
+		if !result.success {
+			os.Exit(exitCode(result.err, exitProbeFailed))
+		}
+		if *iceHostOverride != "" && !result.matchesHostOverride(*iceHostOverride) {
+			os.Exit(exitProbeFailed)
+		}
+
+	case "turn":
+		username, password := *turnUser, *turnPassword
+		if *turnSecret != "" {
+			username, password = turnCredentialsFromSecret(*turnUser, *turnSecret)
+		}
+		result := testTURNAllocate(*host, *port, strings.ToLower(*transport), username, password, dialer)
+		printTURNResult(result)
+		if !result.success {
+			os.Exit(exitCode(result.err, exitProbeFailed))
 		}
 
 	case "tls":
-		result := testTLSHandshake(*host, *port, *timeout)
+		result := testTLSHandshake(*host, *port, alpnProtocols, dialer)
 		printTLSResult(result, *host, *port)
 		if !result.success {
-			os.Exit(1)
+			os.Exit(exitCode(result.err, exitProbeFailed))
 		}
 
 	case "tls-insecure":
-		result := testTLSHandshakeInsecure(*host, *port, *timeout)
+		result := testTLSHandshakeInsecure(*host, *port, alpnProtocols, dialer)
 		printTLSResult(result, *host, *port)
 		if !result.success {
-			os.Exit(1)
+			os.Exit(exitCode(result.err, exitProbeFailed))
 		}
 
 	case "tls-sni":
 		if *sni == "" {
 			fmt.Fprintf(os.Stderr, "Error: SNI is required for tls-sni mode\n")
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
-		result := testTLSHandshakeWithSNI(*host, *port, *sni, *timeout)
+		result := testTLSHandshakeWithSNI(*host, *port, *sni, alpnProtocols, dialer)
 		printTLSResult(result, *host, *port)
 		if !result.success {
-			os.Exit(1)
+			os.Exit(exitCode(result.err, exitProbeFailed))
 		}
 
 	case "tls-postgres":
-		result := testPostgresSTARTTLS(*host, *port, *timeout)
+		result := testPostgresSTARTTLS(*host, *port, alpnProtocols, dialer)
 		printTLSResult(result, *host, *port)
 		if !result.success {
-			os.Exit(1)
+			os.Exit(exitCode(result.err, exitProbeFailed))
 		}
 
 	case "tls-ldap":
-		result := testLDAPSTARTTLS(*host, *port, *timeout)
+		result := testLDAPSTARTTLS(*host, *port, alpnProtocols, dialer)
 		printTLSResult(result, *host, *port)
 		if !result.success {
-			os.Exit(1)
+			os.Exit(exitCode(result.err, exitProbeFailed))
+		}
+
+	case "http":
+		target := mattermostBaseURL(*rawURL, *host, *port)
+		if *mattermost {
+			target += mattermostPingPath
+		}
+		result := testHTTPRequest(target, *sni, *insecure, dialer)
+		printHTTPResult(result)
+		// An unhealthy server answers the ping with 500 and the status JSON, so the
+		// table is shown for any response with a JSON body.
+		healthy := true
+		if *mattermost && result.statusCode != 0 {
+			ok, err := PrintMattermostPing(result)
+			switch {
+			case err == nil:
+				healthy = ok
+			case result.success:
+				fmt.Printf("Failed to read Mattermost server status: %v\n", err)
+				os.Exit(exitProbeFailed)
+			}
+		}
+		if !result.success {
+			os.Exit(exitCode(result.err, exitProbeFailed))
+		}
+		if !healthy {
+			os.Exit(exitProbeFailed)
+		}
+
+	case "http2":
+		result := testHTTP2(*host, *port, *sni, *insecure, dialer)
+		printHTTP2Result(result)
+		if !result.success {
+			os.Exit(exitCode(result.err, exitProbeFailed))
+		}
+
+	case "websocket":
+		result := testWebSocket(mattermostBaseURL(*rawURL, *host, *port), *sni, *token, *insecure, dialer, *wsDuration)
+		printWebSocketResult(result, *token)
+		if !result.success(*token) {
+			os.Exit(exitCode(result.err, exitProbeFailed))
+		}
+
+	case "route":
+		err := PrintRoute(*host, *bindIP, *iface)
+		if err != nil {
+			fmt.Printf("Failed to look up route: %v\n", err)
+			os.Exit(exitCode(err, exitProbeFailed))
+		}
+
+	case "batch":
+		if *batchFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: -file is required for batch mode\n")
+			os.Exit(exitUsage)
+		}
+		failed, err := PrintBatch(*batchFile, *workers, dialer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		if failed > 0 {
+			os.Exit(exitProbeFailed)
 		}
 
 	case "ulimits":
-		err := PrintUlimits()
+		ok, err := PrintUlimits(selector, *threadWarn)
 		if err != nil {
 			fmt.Printf("Failed to get ulimits: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+		if !ok {
+			os.Exit(exitSystemCheck)
 		}
 
 	case "mm-env":
-		err := PrintMattermostProcessEnv()
+		err := PrintMattermostProcessEnv(selector)
 		if err != nil {
 			fmt.Printf("Failed to get Mattermost environment variables: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+
+		ok, err := PrintMattermostGoRuntimeLimits(selector)
+		if err != nil {
+			fmt.Printf("Failed to compare Go runtime settings with cgroup limits: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+		if !ok {
+			os.Exit(exitSystemCheck)
+		}
+
+	case "mm-proxy":
+		err := PrintMattermostProxyEvaluation(selector, strings.Split(*targets, ","))
+		if err != nil {
+			fmt.Printf("Failed to evaluate Mattermost proxy settings: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+
+	case "mm-fds":
+		ok, err := PrintMattermostFDs(selector, *fdWarn)
+		if err != nil {
+			fmt.Printf("Failed to count Mattermost file descriptors: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+		if !ok {
+			os.Exit(exitSystemCheck)
+		}
+
+	case "mm-proc":
+		err := PrintMattermostProcessOverview(selector)
+		if err != nil {
+			fmt.Printf("Failed to get Mattermost process overview: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+
+	case "mm-plugins":
+		err := PrintMattermostPlugins(selector)
+		if err != nil {
+			fmt.Printf("Failed to inspect Mattermost plugin processes: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+
+	case "mm-version":
+		err := PrintMattermostVersion(selector)
+		if err != nil {
+			fmt.Printf("Failed to read Mattermost build info: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+
+	case "cgroup":
+		ok, err := PrintMattermostCgroup(selector)
+		if err != nil {
+			fmt.Printf("Failed to read the Mattermost cgroup: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+		if !ok {
+			os.Exit(exitSystemCheck)
+		}
+
+	case "pressure":
+		if *window <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: -pressure-window must be positive\n")
+			os.Exit(exitUsage)
+		}
+		err := PrintPressure(selector, *window)
+		if err != nil {
+			fmt.Printf("Failed to sample pressure stall information: %v\n", err)
+			os.Exit(exitCode(err, exitSystemCheck))
 		}
 
 	case "sysctl":
-		err := PrintSysctls()
+		ok, err := PrintSysctls()
 		if err != nil {
 			fmt.Printf("Failed to get sysctl parameters: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err, exitSystemCheck))
+		}
+		if !ok {
+			os.Exit(exitSystemCheck)
 		}
 
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown mode '%s'\n", *mode)
-		fmt.Fprintf(os.Stderr, "Available modes: tcp, tls, tls-insecure, tls-sni, tls-postgres, tls-ldap, ulimits, mm-env, sysctl\n")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Available modes: tcp, udp, udp-responder, stun, turn, http, http2, websocket, route, batch, tls, tls-insecure, tls-sni, tls-postgres, tls-ldap, ulimits, mm-env, mm-proxy, mm-fds, mm-proc, mm-plugins, mm-version, cgroup, pressure, sysctl\n")
+		os.Exit(exitUsage)
 	}
 }
 
+// modeRequiresHost reports whether the given mode needs a -host to operate on.
+func modeRequiresHost(mode string) bool {
+	switch strings.ToLower(mode) {
+	case "udp-responder", "batch", "ulimits", "mm-env", "mm-proxy", "mm-fds", "mm-proc", "mm-plugins", "mm-version", "cgroup", "pressure", "sysctl":
+		return false
+	default:
+		return true
+	}
+}
+
+// modeUsesProxy reports whether the given mode makes TCP connections that honor -proxy.
+func modeUsesProxy(mode, transport string) bool {
+	switch strings.ToLower(mode) {
+	case "udp", "udp-responder", "route", "batch", "ulimits", "mm-env", "mm-proxy", "mm-fds", "mm-proc", "mm-plugins", "mm-version", "cgroup", "pressure", "sysctl":
+		return false
+	case "stun", "turn":
+		return strings.ToLower(transport) != "udp"
+	default:
+		return true
+	}
+}
+
+// flagWasSet reports whether the named flag was given on the command line.
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 // printTLSResult outputs TLS test results in a formatted way.
 func printTLSResult(result *tlsTestResult, host string, port int) {
 	if result.success {
@@ -107,9 +444,13 @@ func printTLSResult(result *tlsTestResult, host string, port int) {
 		fmt.Printf("  TLS Version: %s\n", tlsVersionString(result.version))
 		fmt.Printf("  Cipher Suite: %s\n", cipherSuiteString(result.cipherSuite))
 		fmt.Printf("  Server Name: %s\n", result.serverName)
+		if result.negotiatedProtocol != "" {
+			fmt.Printf("  ALPN Protocol: %s\n", result.negotiatedProtocol)
+		}
 		fmt.Printf("  Peer Certificates: %d\n", result.peerCertificates)
 	} else {
 		fmt.Printf("TLS connection to %s:%d failed: %v\n", host, port, result.err)
+		printLikelyCause(result.err)
 	}
 }
 
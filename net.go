@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/text"
@@ -12,11 +16,11 @@ import (
 // testTCPConnection tests if a TCP connection can be established to the given host and port.
 // It returns an error if the connection fails within the specified timeout duration.
 // The connection is automatically closed after successful establishment.
-func testTCPConnection(host string, port int, timeout time.Duration) error {
-	address := fmt.Sprintf("%s:%d", host, port)
+func testTCPConnection(host string, port int, dialer *probeDialer) error {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	start := time.Now()
 
-	conn, err := net.DialTimeout("tcp", address, timeout)
+	conn, err := dialer.Dial("tcp", address)
 	if err != nil {
 		duration := time.Since(start)
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -32,9 +36,201 @@ func testTCPConnection(host string, port int, timeout time.Duration) error {
 func printTCPResult(host string, port int, err error) {
 	if err != nil {
 		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("TCP connection to %s:%d failed", host, port))
+		fmt.Printf("  Error: %v\n", err)
+		printLikelyCause(err)
 	} else {
 		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("TCP connection to %s:%d successful", host, port))
 	}
 }
 
+// udpProbePrefix and udpReplyPrefix mark the payloads exchanged between the
+// udp mode and an mmdebug responder on the other end.
+const (
+	udpProbePrefix = "MMDEBUG-PROBE"
+	udpReplyPrefix = "MMDEBUG-REPLY"
+)
+
+// udpTestResult contains information about a UDP reachability test.
+type udpTestResult struct {
+	sent     int
+	received int
+	refused  bool
+	rtts     []time.Duration
+	err      error
+}
+
+// success reports whether at least one probe was answered by the remote end.
+func (r *udpTestResult) success() bool {
+	return r.err == nil && !r.refused && r.received > 0
+}
+
+// exitCode maps a failed UDP test to an exit code. Without any reply the probes
+// are reported as timed out, since the port may be open or filtered.
+func (r *udpTestResult) exitCode() int {
+	switch {
+	case r.err != nil:
+		return exitCode(r.err, exitProbeFailed)
+	case r.refused:
+		return exitRefused
+	case r.received == 0:
+		return exitTimeout
+	default:
+		return exitProbeFailed
+	}
+}
+
+// testUDPConnection sends count probes to the given host and port over a connected UDP socket.
+// Replies from an mmdebug responder confirm round-trip reachability and are used to measure RTT.
+// Against other services an ICMP port-unreachable is surfaced by the kernel as ECONNREFUSED,
+// which is reported as refused; silence means the port is either open or filtered.
+func testUDPConnection(host string, port int, count int, dialer *probeDialer) *udpTestResult {
+	result := &udpTestResult{}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	if count < 1 {
+		count = 1
+	}
+
+	conn, err := dialer.Dial("udp", address)
+	if err != nil {
+		result.err = fmt.Errorf("UDP socket to %s failed: %w", address, err)
+		return result
+	}
+	defer conn.Close()
+
+	wait := dialer.timeout / time.Duration(count)
+	buf := make([]byte, 512)
+
+	for seq := 1; seq <= count; seq++ {
+		probe := fmt.Sprintf("%s %d %d", udpProbePrefix, seq, time.Now().UnixNano())
+		start := time.Now()
+
+		if _, err := conn.Write([]byte(probe)); err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				result.refused = true
+				return result
+			}
+			result.err = fmt.Errorf("failed to send UDP probe: %w", err)
+			return result
+		}
+		result.sent++
+
+		deadline := start.Add(wait)
+		for {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				result.err = fmt.Errorf("failed to set read deadline: %w", err)
+				return result
+			}
+
+			n, err := conn.Read(buf)
+			if err != nil {
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					result.refused = true
+					return result
+				}
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				result.err = fmt.Errorf("failed to read UDP reply: %w", err)
+				return result
+			}
 
+			// Ignore stale replies to earlier probes that arrived after their wait expired.
+			if string(buf[:n]) == udpReplyPrefix+strings.TrimPrefix(probe, udpProbePrefix) {
+				result.received++
+				result.rtts = append(result.rtts, time.Since(start))
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// runUDPResponder answers mmdebug UDP probes on the given address until an error occurs.
+// It is meant to run on the far end of a udp test, e.g. on a Calls or cluster node.
+func runUDPResponder(host string, port int) error {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Answering UDP probes on %s (Ctrl+C to stop)", conn.LocalAddr()))
+
+	buf := make([]byte, 512)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("failed to read UDP probe: %w", err)
+		}
+
+		payload := string(buf[:n])
+		if !strings.HasPrefix(payload, udpProbePrefix) {
+			continue
+		}
+
+		reply := udpReplyPrefix + strings.TrimPrefix(payload, udpProbePrefix)
+		if _, err := conn.WriteTo([]byte(reply), peer); err != nil {
+			fmt.Printf("Failed to answer %s: %v\n", peer, err)
+			continue
+		}
+		fmt.Printf("%s answered probe from %s\n", time.Now().Format(time.RFC3339), peer)
+	}
+}
+
+// printUDPResult prints a colorized UDP test result
+func printUDPResult(result *udpTestResult, host string, port int) {
+	switch {
+	case result.err != nil:
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("UDP probe to %s:%d failed: %v", host, port, result.err))
+	case result.refused:
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("UDP port %s:%d unreachable (ICMP port unreachable received)", host, port))
+	case result.received == 0:
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgYellow}.Sprintf("UDP probe to %s:%d got no reply (%d sent): port is open or filtered", host, port, result.sent))
+		fmt.Printf("  Run 'mmdebug -mode udp-responder -port %d' on the target to confirm reachability\n", port)
+	default:
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("UDP round trip to %s:%d successful", host, port))
+		fmt.Printf("  Replies: %d/%d\n", result.received, result.sent)
+		fmt.Printf("  RTT min/avg/max: %v/%v/%v\n", minDuration(result.rtts), avgDuration(result.rtts), maxDuration(result.rtts))
+	}
+}
+
+// minDuration returns the smallest duration in ds, or zero if ds is empty.
+func minDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	m := ds[0]
+	for _, d := range ds[1:] {
+		if d < m {
+			m = d
+		}
+	}
+	return m
+}
+
+// maxDuration returns the largest duration in ds, or zero if ds is empty.
+func maxDuration(ds []time.Duration) time.Duration {
+	var m time.Duration
+	for _, d := range ds {
+		if d > m {
+			m = d
+		}
+	}
+	return m
+}
+
+// avgDuration returns the mean of ds, or zero if ds is empty.
+func avgDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range ds {
+		total += d
+	}
+	return total / time.Duration(len(ds))
+}
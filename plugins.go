@@ -0,0 +1,231 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prometheus/procfs"
+)
+
+// pluginCPUSampleInterval is how long CPU time is sampled to compute current CPU usage.
+const pluginCPUSampleInterval = time.Second
+
+// pluginIDFromPath extracts the plugin ID from an executable under the server's
+// plugins directory, e.g. /opt/mattermost/plugins/com.mattermost.calls/server/dist/plugin-linux-amd64.
+var pluginIDFromPath = regexp.MustCompile(`(?:^|/)plugins/([^/]+)/`)
+
+// pluginProcess is a process running under the Mattermost server.
+type pluginProcess struct {
+	pid      int
+	pluginID string
+	exe      string
+	rss      uint64
+	cpuTime  time.Duration
+	cpuUsage float64
+	fds      int
+	threads  int
+	started  time.Time
+}
+
+// cpuTicks returns the user and system CPU time of a process in clock ticks.
+func cpuTicks(proc procfs.Proc) (uint, error) {
+	stat, err := proc.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.UTime + stat.STime, nil
+}
+
+// GetMattermostPlugins walks the process tree under the Mattermost process and maps
+// each descendant to its plugin ID. CPU usage is sampled over cpuSample, or left at
+// zero when cpuSample is zero.
+func GetMattermostPlugins(selector *processSelector, cpuSample time.Duration) (int, []pluginProcess, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	mm, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fs, err := procfs.NewFS("/proc")
+	if err != nil {
+		return 0, nil, fmt.Errorf("procfs access failed: %w", err)
+	}
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get process list: %w", err)
+	}
+
+	children := make(map[int][]procfs.Proc)
+	for _, proc := range procs {
+		if stat, err := proc.Stat(); err == nil {
+			children[stat.PPID] = append(children[stat.PPID], proc)
+		}
+	}
+
+	var descendants []procfs.Proc
+	queue := []int{mm.PID}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, child := range children[pid] {
+			descendants = append(descendants, child)
+			queue = append(queue, child.PID)
+		}
+	}
+
+	before := make(map[int]uint, len(descendants))
+	for _, proc := range descendants {
+		if ticks, err := cpuTicks(proc); err == nil {
+			before[proc.PID] = ticks
+		}
+	}
+	time.Sleep(cpuSample)
+
+	plugins := make([]pluginProcess, 0, len(descendants))
+	for _, proc := range descendants {
+		stat, err := proc.Stat()
+		if err != nil {
+			// The process exited while sampling.
+			continue
+		}
+
+		plugin := pluginProcess{
+			pid:     proc.PID,
+			rss:     uint64(stat.ResidentMemory()),
+			cpuTime: time.Duration(stat.UTime+stat.STime) * time.Second / clockTicksPerSecond,
+			threads: stat.NumThreads,
+		}
+		if ticks, ok := before[proc.PID]; ok && cpuSample > 0 && stat.UTime+stat.STime >= ticks {
+			used := float64(stat.UTime+stat.STime-ticks) / clockTicksPerSecond
+			plugin.cpuUsage = used * 100 / cpuSample.Seconds()
+		}
+		if started, err := stat.StartTime(); err == nil {
+			plugin.started = time.Unix(int64(started), 0)
+		}
+		if fds, err := proc.FileDescriptorsLen(); err == nil {
+			plugin.fds = fds
+		} else {
+			plugin.fds = -1
+		}
+
+		// The exe link needs the same user or root; fall back to argv[0].
+		plugin.exe, _ = proc.Executable()
+		if plugin.exe == "" {
+			if args, err := proc.CmdLine(); err == nil && len(args) > 0 {
+				plugin.exe = args[0]
+			}
+		}
+		if match := pluginIDFromPath.FindStringSubmatch(plugin.exe); match != nil {
+			plugin.pluginID = match[1]
+		}
+
+		plugins = append(plugins, plugin)
+	}
+
+	sort.Slice(plugins, func(i, j int) bool {
+		if plugins[i].pluginID != plugins[j].pluginID {
+			return plugins[i].pluginID < plugins[j].pluginID
+		}
+		return plugins[i].pid < plugins[j].pid
+	})
+
+	return mm.PID, plugins, nil
+}
+
+// pluginsState lists the plugin processes as ID=PID, so that a plugin that exits or
+// restarts changes it.
+func pluginsState(plugins []pluginProcess) string {
+	if len(plugins) == 0 {
+		return "no plugin processes"
+	}
+	parts := make([]string, 0, len(plugins))
+	for _, plugin := range plugins {
+		name := plugin.pluginID
+		if name == "" {
+			name = filepath.Base(plugin.exe)
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", name, plugin.pid))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pluginsSummary returns the number and total memory of the plugin processes.
+func pluginsSummary(plugins []pluginProcess) string {
+	var rss uint64
+	for _, plugin := range plugins {
+		rss += plugin.rss
+	}
+	return fmt.Sprintf("%d plugin processes, RSS %s", len(plugins), formatBytes(rss))
+}
+
+// PrintMattermostPlugins prints the plugin processes of the Mattermost server with
+// their memory, CPU, file descriptors and uptime.
+func PrintMattermostPlugins(selector *processSelector) error {
+	pid, plugins, err := GetMattermostPlugins(selector, pluginCPUSampleInterval)
+	if err != nil {
+		return err
+	}
+
+	if len(plugins) == 0 {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgYellow}.Sprintf("No plugin processes found under Mattermost (PID %d)", pid))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"PID", "Plugin", "RSS", "CPU", "CPU Time", "FDs", "Threads", "Uptime"})
+
+	var totalRSS uint64
+	var totalCPU float64
+	totalFDs := 0
+	for _, plugin := range plugins {
+		name := plugin.pluginID
+		if name == "" {
+			name = text.Colors{text.Faint}.Sprintf("%s (not a plugin)", filepath.Base(plugin.exe))
+		}
+
+		fds := fmt.Sprint(plugin.fds)
+		if plugin.fds < 0 {
+			fds = text.Colors{text.Faint}.Sprint("n/a")
+		} else {
+			totalFDs += plugin.fds
+		}
+
+		uptime := ""
+		if !plugin.started.IsZero() {
+			uptime = time.Since(plugin.started).Round(time.Second).String()
+		}
+
+		totalRSS += plugin.rss
+		totalCPU += plugin.cpuUsage
+		t.AppendRow(table.Row{
+			plugin.pid,
+			name,
+			formatBytes(plugin.rss),
+			fmt.Sprintf("%.1f%%", plugin.cpuUsage),
+			plugin.cpuTime,
+			fds,
+			plugin.threads,
+			uptime,
+		})
+	}
+	t.AppendFooter(table.Row{"", "Total", formatBytes(totalRSS), fmt.Sprintf("%.1f%%", totalCPU), "", totalFDs, "", ""})
+
+	t.SetStyle(table.StyleDefault)
+	t.Style().Format.Footer = text.FormatDefault
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Mattermost Plugin Processes (PID %d, CPU sampled over %v):", pid, pluginCPUSampleInterval))
+	t.Render()
+
+	return nil
+}
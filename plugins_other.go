@@ -0,0 +1,31 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// pluginProcess is a process running under the Mattermost server.
+type pluginProcess struct{}
+
+// pluginsState lists the plugin processes as ID=PID.
+func pluginsState(plugins []pluginProcess) string {
+	return ""
+}
+
+// pluginsSummary returns the number and total memory of the plugin processes.
+func pluginsSummary(plugins []pluginProcess) string {
+	return ""
+}
+
+// GetMattermostPlugins is not available outside Linux, where /proc is used.
+func GetMattermostPlugins(selector *processSelector, cpuSample time.Duration) (int, []pluginProcess, error) {
+	return 0, nil, fmt.Errorf("plugin process inspection is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostPlugins is not available outside Linux, where /proc is used.
+func PrintMattermostPlugins(selector *processSelector) error {
+	return fmt.Errorf("plugin process inspection is %w", errUnsupportedPlatform)
+}
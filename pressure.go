@@ -0,0 +1,265 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// pressureWarnPercent is the share of the sampling window stalled on a resource above
+// which the stall time is highlighted.
+const pressureWarnPercent = 10
+
+// pressureResources are the resources the kernel reports pressure stall information for.
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// psiLine is one line of a pressure file. The averages are percentages of wall time,
+// total is the accumulated stall time in microseconds.
+type psiLine struct {
+	avg10  float64
+	avg60  float64
+	avg300 float64
+	total  uint64
+}
+
+// psiStats are the "some" and "full" lines of a pressure file. full is nil when the
+// kernel does not report it, as for host cpu before Linux 5.13.
+type psiStats struct {
+	some *psiLine
+	full *psiLine
+}
+
+// pressureSample is a pressure file read at the start and the end of the window.
+type pressureSample struct {
+	scope    string
+	resource string
+	before   psiStats
+	after    psiStats
+}
+
+// pressureReport is the result of GetPressure.
+type pressureReport struct {
+	window    time.Duration
+	pid       int
+	cgroup    string
+	cgroupErr error
+	samples   []pressureSample
+}
+
+// readPSIFile parses /proc/pressure/<resource> or <cgroup>/<resource>.pressure.
+func readPSIFile(path string) (psiStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return psiStats{}, err
+	}
+
+	stats, err := parsePSI(string(data))
+	if err != nil {
+		return psiStats{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// parsePSI parses the content of a pressure file, one "some" or "full" line followed by
+// key=value fields.
+func parsePSI(data string) (psiStats, error) {
+	var stats psiStats
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		psi := &psiLine{}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			var err error
+			switch key {
+			case "avg10":
+				psi.avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				psi.avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				psi.avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				psi.total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return psiStats{}, err
+			}
+		}
+		switch fields[0] {
+		case "some":
+			stats.some = psi
+		case "full":
+			stats.full = psi
+		}
+	}
+
+	return stats, nil
+}
+
+// stalledInWindow returns the stall time accumulated between two reads of a pressure
+// line and its share of window. A total that went backwards, as when the cgroup was
+// recreated in between, counts as no stall.
+func stalledInWindow(before, after *psiLine, window time.Duration) (time.Duration, float64) {
+	if after.total < before.total || window <= 0 {
+		return 0, 0
+	}
+	stalled := time.Duration(after.total-before.total) * time.Microsecond
+	return stalled, float64(stalled) * 100 / float64(window)
+}
+
+// GetPressure samples the host's pressure stall information and, when the Mattermost
+// process is found, that of its cgroup, at the start and the end of window.
+func GetPressure(selector *processSelector, window time.Duration) (*pressureReport, error) {
+	if _, err := os.Stat("/proc/pressure"); err != nil {
+		return nil, fmt.Errorf("pressure stall information is not available, the kernel needs CONFIG_PSI and psi=1: %w", err)
+	}
+
+	report := &pressureReport{window: window}
+	paths := make(map[string]string)
+	for _, resource := range pressureResources {
+		paths["host/"+resource] = "/proc/pressure/" + resource
+	}
+
+	// The host is always sampled; the cgroup is skipped when the process is not found,
+	// unless it was selected explicitly.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	var multiple *multipleProcessesError
+	if err != nil && (selector.explicit() || errors.As(err, &multiple)) {
+		return nil, err
+	}
+	if err == nil {
+		report.pid = proc.PID
+		report.cgroup, err = processCgroupDir(proc)
+	}
+	if err != nil {
+		report.cgroupErr = err
+	} else {
+		for _, resource := range pressureResources {
+			paths["cgroup/"+resource] = filepath.Join(report.cgroup, resource+".pressure")
+		}
+	}
+
+	before := make(map[string]psiStats)
+	for key, path := range paths {
+		if stats, err := readPSIFile(path); err == nil {
+			before[key] = stats
+		}
+	}
+	time.Sleep(window)
+
+	for _, scope := range []string{"host", "cgroup"} {
+		for _, resource := range pressureResources {
+			key := scope + "/" + resource
+			start, ok := before[key]
+			if !ok {
+				continue
+			}
+			end, err := readPSIFile(paths[key])
+			if err != nil {
+				continue
+			}
+			report.samples = append(report.samples, pressureSample{scope: scope, resource: resource, before: start, after: end})
+		}
+	}
+
+	if len(report.samples) == 0 {
+		return nil, fmt.Errorf("no readable pressure files in /proc/pressure")
+	}
+
+	return report, nil
+}
+
+// problems returns the scopes and resources whose "some" stall average over the last
+// 10 seconds is at or above pressureWarnPercent.
+func (r *pressureReport) problems() []string {
+	var problems []string
+	for _, sample := range r.samples {
+		if sample.after.some != nil && sample.after.some.avg10 >= pressureWarnPercent {
+			problems = append(problems, sample.scope+"/"+sample.resource)
+		}
+	}
+	return problems
+}
+
+// summary returns the "some" stall averages over the last 10 seconds in one line.
+func (r *pressureReport) summary() string {
+	parts := make([]string, 0, len(r.samples))
+	for _, sample := range r.samples {
+		if sample.after.some != nil {
+			parts = append(parts, fmt.Sprintf("%s/%s %.2f%%", sample.scope, sample.resource, sample.after.some.avg10))
+		}
+	}
+	return "avg10 " + strings.Join(parts, ", ")
+}
+
+// PrintPressure samples pressure stall information over window and prints the kernel's
+// averages next to the stall time accumulated during the window.
+func PrintPressure(selector *processSelector, window time.Duration) error {
+	report, err := GetPressure(selector, window)
+	if err != nil {
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Scope", "Resource", "Type", "avg10", "avg60", "avg300", "Stalled in Window"})
+
+	for _, sample := range report.samples {
+		lines := []struct {
+			typ           string
+			before, after *psiLine
+		}{
+			{"some", sample.before.some, sample.after.some},
+			{"full", sample.before.full, sample.after.full},
+		}
+		for _, line := range lines {
+			if line.before == nil || line.after == nil {
+				continue
+			}
+
+			stalled, percent := stalledInWindow(line.before, line.after, report.window)
+			color := text.Colors{}
+			if percent >= pressureWarnPercent {
+				color = text.Colors{text.Bold, text.FgYellow}
+			}
+
+			t.AppendRow(table.Row{
+				sample.scope,
+				sample.resource,
+				line.typ,
+				fmt.Sprintf("%.2f%%", line.after.avg10),
+				fmt.Sprintf("%.2f%%", line.after.avg60),
+				fmt.Sprintf("%.2f%%", line.after.avg300),
+				color.Sprintf("%v (%.1f%%)", stalled.Round(time.Millisecond), percent),
+			})
+		}
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Pressure Stall Information (sampled over %v):", report.window))
+	if report.cgroupErr == nil {
+		fmt.Printf("  Cgroup: %s (PID %d)\n", report.cgroup, report.pid)
+	}
+	t.Render()
+	fmt.Printf("  some: at least one task stalled on the resource, full: all non-idle tasks stalled at once\n")
+
+	if report.cgroupErr != nil {
+		fmt.Printf("%s\n", text.Colors{text.FgYellow}.Sprintf("Mattermost cgroup not sampled: %v", report.cgroupErr))
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// pressureReport is the result of GetPressure.
+type pressureReport struct{}
+
+// problems returns the resources under pressure.
+func (r *pressureReport) problems() []string {
+	return nil
+}
+
+// summary returns the stall averages in one line.
+func (r *pressureReport) summary() string {
+	return ""
+}
+
+// GetPressure is not available outside Linux, where /proc/pressure is used.
+func GetPressure(selector *processSelector, window time.Duration) (*pressureReport, error) {
+	return nil, fmt.Errorf("pressure stall information is %w", errUnsupportedPlatform)
+}
+
+// PrintPressure is not available outside Linux, where /proc/pressure is used.
+func PrintPressure(selector *processSelector, window time.Duration) error {
+	return fmt.Errorf("pressure stall information is %w", errUnsupportedPlatform)
+}
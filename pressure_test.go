@@ -0,0 +1,124 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantSome *psiLine
+		wantFull *psiLine
+		wantErr  bool
+	}{
+		{
+			name: "memory",
+			data: "some avg10=1.53 avg60=0.87 avg300=0.24 total=8841234\n" +
+				"full avg10=0.61 avg60=0.33 avg300=0.09 total=3312987\n",
+			wantSome: &psiLine{avg10: 1.53, avg60: 0.87, avg300: 0.24, total: 8841234},
+			wantFull: &psiLine{avg10: 0.61, avg60: 0.33, avg300: 0.09, total: 3312987},
+		},
+		{
+			// Host cpu has no full line before Linux 5.13.
+			name:     "cpu without full line",
+			data:     "some avg10=12.40 avg60=9.81 avg300=4.02 total=912345678\n",
+			wantSome: &psiLine{avg10: 12.40, avg60: 9.81, avg300: 4.02, total: 912345678},
+		},
+		{
+			// Since Linux 5.13 host cpu reports a full line that is always zero.
+			name: "cpu with zero full line",
+			data: "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n" +
+				"full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+			wantSome: &psiLine{},
+			wantFull: &psiLine{},
+		},
+		{
+			name:    "malformed average",
+			data:    "some avg10=high avg60=0.00 avg300=0.00 total=0\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative total",
+			data:    "some avg10=0.00 avg60=0.00 avg300=0.00 total=-5\n",
+			wantErr: true,
+		},
+		{name: "empty", data: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := parsePSI(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePSI = %+v, want error", stats)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePSI: %v", err)
+			}
+			checkPSILine(t, "some", stats.some, tt.wantSome)
+			checkPSILine(t, "full", stats.full, tt.wantFull)
+		})
+	}
+}
+
+func checkPSILine(t *testing.T, typ string, got, want *psiLine) {
+	t.Helper()
+	if got == nil || want == nil {
+		if got != want {
+			t.Errorf("%s = %+v, want %+v", typ, got, want)
+		}
+		return
+	}
+	if *got != *want {
+		t.Errorf("%s = %+v, want %+v", typ, *got, *want)
+	}
+}
+
+func TestReadPSIFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cpu.pressure")
+	if err := os.WriteFile(path, []byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=1\nfull avg10=x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPSIFile(path); err == nil {
+		t.Error("readPSIFile of malformed content succeeded")
+	}
+	if _, err := readPSIFile(filepath.Join(dir, "io.pressure")); err == nil {
+		t.Error("readPSIFile of a missing file succeeded")
+	}
+}
+
+func TestStalledInWindow(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      uint64
+		after       uint64
+		window      time.Duration
+		wantStalled time.Duration
+		wantPercent float64
+	}{
+		{name: "idle", before: 5000, after: 5000, window: 10 * time.Second},
+		{name: "one second of ten", before: 1000000, after: 2000000, window: 10 * time.Second, wantStalled: time.Second, wantPercent: 10},
+		{name: "stalled the whole window", before: 0, after: 2000000, window: 2 * time.Second, wantStalled: 2 * time.Second, wantPercent: 100},
+		{name: "microseconds", before: 100, after: 1600, window: 10 * time.Millisecond, wantStalled: 1500 * time.Microsecond, wantPercent: 15},
+		{name: "total went backwards", before: 9000000, after: 12, window: 10 * time.Second},
+		{name: "no window", before: 0, after: 1000, window: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stalled, percent := stalledInWindow(&psiLine{total: tt.before}, &psiLine{total: tt.after}, tt.window)
+			if stalled != tt.wantStalled || percent != tt.wantPercent {
+				t.Errorf("stalledInWindow = %v %.2f%%, want %v %.2f%%", stalled, percent, tt.wantStalled, tt.wantPercent)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// clockTicksPerSecond is USER_HZ, the unit of the CPU times in /proc/<pid>/stat. It is
+// fixed at 100 by the Linux ABI regardless of the kernel's CONFIG_HZ.
+const clockTicksPerSecond = 100
+
+// processOverview is what support usually collects about the server with ps, cat and ls.
+type processOverview struct {
+	pid          int
+	ppid         int
+	state        string
+	user         string
+	group        string
+	cmdline      string
+	cwd          string
+	exe          string
+	started      time.Time
+	rss          uint64
+	pss          uint64
+	anonymous    uint64
+	swap         uint64
+	vsz          uint64
+	userTime     time.Duration
+	systemTime   time.Duration
+	threads      int
+	voluntary    uint64
+	involuntary  uint64
+	oomScore     string
+	oomScoreAdj  string
+	cgroups      []string
+	smapsMissing bool
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 GiB.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// lookupGroupname returns the name of gid, or the numeric GID if it has no group entry.
+func lookupGroupname(gid uint64) string {
+	id := strconv.FormatUint(gid, 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// GetMattermostProcessOverview gathers identity, memory, CPU and scheduling details of
+// the Mattermost process from /proc.
+func GetMattermostProcessOverview(selector *processSelector) (*processOverview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := proc.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stat of PID %d: %w", proc.PID, err)
+	}
+	status, err := proc.NewStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status of PID %d: %w", proc.PID, err)
+	}
+
+	info := &processOverview{
+		pid:         proc.PID,
+		ppid:        stat.PPID,
+		state:       stat.State,
+		user:        lookupUsername(status.UIDs[0]),
+		group:       lookupGroupname(status.GIDs[0]),
+		vsz:         uint64(stat.VirtualMemory()),
+		userTime:    time.Duration(stat.UTime) * time.Second / clockTicksPerSecond,
+		systemTime:  time.Duration(stat.STime) * time.Second / clockTicksPerSecond,
+		threads:     stat.NumThreads,
+		voluntary:   status.VoluntaryCtxtSwitches,
+		involuntary: status.NonVoluntaryCtxtSwitches,
+	}
+
+	if started, err := stat.StartTime(); err == nil {
+		info.started = time.Unix(int64(started), 0)
+	}
+	if args, err := proc.CmdLine(); err == nil {
+		info.cmdline = strings.Join(args, " ")
+	}
+	// cwd and exe need the same user or root; they are left empty otherwise.
+	info.cwd, _ = proc.Cwd()
+	info.exe, _ = proc.Executable()
+
+	// smaps_rollup needs PTRACE_MODE_READ; fall back to the RSS in stat.
+	if rollup, err := proc.ProcSMapsRollup(); err == nil {
+		info.rss, info.pss, info.anonymous, info.swap = rollup.Rss, rollup.Pss, rollup.Anonymous, rollup.Swap
+	} else {
+		info.rss = uint64(stat.ResidentMemory())
+		info.smapsMissing = true
+	}
+
+	base := "/proc/" + strconv.Itoa(proc.PID)
+	if data, err := os.ReadFile(base + "/oom_score"); err == nil {
+		info.oomScore = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(base + "/oom_score_adj"); err == nil {
+		info.oomScoreAdj = strings.TrimSpace(string(data))
+	}
+
+	if cgroups, err := proc.Cgroups(); err == nil {
+		for _, cgroup := range cgroups {
+			name := strings.Join(cgroup.Controllers, ",")
+			if name == "" {
+				name = "unified"
+			}
+			info.cgroups = append(info.cgroups, fmt.Sprintf("%s: %s", name, cgroup.Path))
+		}
+	}
+
+	return info, nil
+}
+
+// summary returns the state, uptime and memory of the process in one line.
+func (o *processOverview) summary() string {
+	uptime := "unknown"
+	if !o.started.IsZero() {
+		uptime = time.Since(o.started).Round(time.Second).String()
+	}
+	return fmt.Sprintf("PID %d state %s, up %s, RSS %s, %d threads", o.pid, o.state, uptime, formatBytes(o.rss), o.threads)
+}
+
+// PrintMattermostProcessOverview prints the Mattermost process overview as a table.
+func PrintMattermostProcessOverview(selector *processSelector) error {
+	info, err := GetMattermostProcessOverview(selector)
+	if err != nil {
+		return err
+	}
+
+	unknown := text.Colors{text.Faint}.Sprint("(permission denied)")
+	orUnknown := func(value string) string {
+		if value == "" {
+			return unknown
+		}
+		return value
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Field", "Value"})
+
+	t.AppendRow(table.Row{"PID", info.pid})
+	t.AppendRow(table.Row{"Parent PID", info.ppid})
+	t.AppendRow(table.Row{"State", info.state})
+	t.AppendRow(table.Row{"User / Group", info.user + " / " + info.group})
+	t.AppendRow(table.Row{"Command Line", info.cmdline})
+	t.AppendRow(table.Row{"Working Directory", orUnknown(info.cwd)})
+
+	// The exe link of a binary replaced by an upgrade points to a deleted file.
+	exe := orUnknown(info.exe)
+	if strings.HasSuffix(info.exe, " (deleted)") {
+		exe = text.Colors{text.Bold, text.FgYellow}.Sprint(info.exe)
+	}
+	t.AppendRow(table.Row{"Executable", exe})
+
+	if !info.started.IsZero() {
+		t.AppendRow(table.Row{"Started", info.started.Format(time.RFC3339)})
+		t.AppendRow(table.Row{"Uptime", time.Since(info.started).Round(time.Second)})
+	}
+
+	if info.smapsMissing {
+		t.AppendRow(table.Row{"RSS", formatBytes(info.rss) + " " + text.Colors{text.Faint}.Sprint("(smaps_rollup not readable)")})
+	} else {
+		t.AppendRow(table.Row{"RSS", formatBytes(info.rss)})
+		t.AppendRow(table.Row{"PSS", formatBytes(info.pss)})
+		t.AppendRow(table.Row{"Anonymous", formatBytes(info.anonymous)})
+		t.AppendRow(table.Row{"Swap", formatBytes(info.swap)})
+	}
+	t.AppendRow(table.Row{"VSZ", formatBytes(info.vsz)})
+
+	t.AppendRow(table.Row{"CPU Time", fmt.Sprintf("%v (user %v, system %v)", info.userTime+info.systemTime, info.userTime, info.systemTime)})
+	t.AppendRow(table.Row{"Threads", info.threads})
+	t.AppendRow(table.Row{"Context Switches", fmt.Sprintf("%d voluntary, %d involuntary", info.voluntary, info.involuntary)})
+	t.AppendRow(table.Row{"OOM Score", fmt.Sprintf("%s (adj %s)", info.oomScore, info.oomScoreAdj)})
+
+	for i, cgroup := range info.cgroups {
+		label := ""
+		if i == 0 {
+			label = "Cgroups"
+		}
+		t.AppendRow(table.Row{label, cgroup})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Mattermost Process (PID %d):", info.pid))
+	t.Render()
+
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// processOverview is what support usually collects about the server with ps, cat and ls.
+type processOverview struct {
+	pid int
+}
+
+// summary returns the state, uptime and memory of the process in one line.
+func (o *processOverview) summary() string {
+	return ""
+}
+
+// GetMattermostProcessOverview is not available outside Linux, where /proc is used.
+func GetMattermostProcessOverview(selector *processSelector) (*processOverview, error) {
+	return nil, fmt.Errorf("the process overview is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostProcessOverview is not available outside Linux, where /proc is used.
+func PrintMattermostProcessOverview(selector *processSelector) error {
+	return fmt.Errorf("the process overview is %w", errUnsupportedPlatform)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyEnvNames are the proxy variables Go's HTTP client honors, in lookup order.
+var proxyEnvNames = []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"}
+
+// mysqlDSNAddress extracts host:port from a MySQL DSN such as user:pass@tcp(db:3306)/mattermost.
+var mysqlDSNAddress = regexp.MustCompile(`@tcp\(([^)]+)\)`)
+
+// proxyTarget is a destination Mattermost connects to. url is nil when the destination
+// could not be determined from the environment; note says why, or which default was assumed.
+type proxyTarget struct {
+	name    string
+	url     *url.URL
+	viaHTTP bool
+	note    string
+}
+
+// proxyEvaluation is the proxy decision for a single target.
+type proxyEvaluation struct {
+	target proxyTarget
+	proxy  *url.URL
+	err    error
+}
+
+// isProxyEnv reports whether name is one of the proxy variables honored by Go.
+func isProxyEnv(name string) bool {
+	for _, n := range proxyEnvNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConfigFromEnv builds an httpproxy.Config from env with the same precedence as
+// httpproxy.FromEnvironment: the upper-case variable wins over the lower-case one.
+func proxyConfigFromEnv(env map[string]string) *httpproxy.Config {
+	get := func(names ...string) string {
+		for _, name := range names {
+			if value := env[name]; value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	return &httpproxy.Config{
+		HTTPProxy:  get("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: get("HTTPS_PROXY", "https_proxy"),
+		NoProxy:    get("NO_PROXY", "no_proxy"),
+	}
+}
+
+// parseProxyTarget parses a URL or host:port into a target. Bare addresses are evaluated
+// as https, like the raw TCP probes.
+func parseProxyTarget(name, value string, viaHTTP bool) (proxyTarget, error) {
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return proxyTarget{}, fmt.Errorf("invalid target '%s'", value)
+	}
+	return proxyTarget{name: name, url: u, viaHTTP: viaHTTP}, nil
+}
+
+// mattermostProxyTargets derives the database, SMTP, push proxy and S3 destinations from
+// the Mattermost environment, followed by any extra targets given as [name=]url-or-host:port.
+func mattermostProxyTargets(env map[string]string, extra []string) ([]proxyTarget, error) {
+	var targets []proxyTarget
+	add := func(name, value string, viaHTTP bool, note string) {
+		target, err := parseProxyTarget(name, value, viaHTTP)
+		if err != nil {
+			target = proxyTarget{name: name, note: fmt.Sprintf("cannot parse %q", value)}
+		}
+		if target.note == "" {
+			target.note = note
+		}
+		targets = append(targets, target)
+	}
+	// Settings that only live in config.json or the database are not visible here.
+	unknown := func(name, variable string) {
+		targets = append(targets, proxyTarget{name: name, note: variable + " not set, configured outside the environment"})
+	}
+
+	if dsn := env["MM_SQLSETTINGS_DATASOURCE"]; dsn != "" {
+		if match := mysqlDSNAddress.FindStringSubmatch(dsn); match != nil {
+			add("Database", match[1], false, "")
+		} else if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+			add("Database", u.Host, false, "")
+		} else {
+			targets = append(targets, proxyTarget{name: "Database", note: "no host in MM_SQLSETTINGS_DATASOURCE"})
+		}
+	} else {
+		unknown("Database", "MM_SQLSETTINGS_DATASOURCE")
+	}
+
+	if server := env["MM_EMAILSETTINGS_SMTPSERVER"]; server != "" {
+		port, note := env["MM_EMAILSETTINGS_SMTPPORT"], ""
+		if port == "" {
+			port, note = "25", "MM_EMAILSETTINGS_SMTPPORT not set, default port assumed"
+		}
+		add("SMTP", net.JoinHostPort(server, port), false, note)
+	} else {
+		unknown("SMTP", "MM_EMAILSETTINGS_SMTPSERVER")
+	}
+
+	if push := env["MM_EMAILSETTINGS_PUSHNOTIFICATIONSERVER"]; push != "" {
+		add("Push Proxy", push, true, "")
+	} else {
+		add("Push Proxy", "https://push.mattermost.com", true, "MM_EMAILSETTINGS_PUSHNOTIFICATIONSERVER not set, default assumed")
+	}
+
+	endpoint, driver := env["MM_FILESETTINGS_AMAZONS3ENDPOINT"], env["MM_FILESETTINGS_DRIVERNAME"]
+	switch {
+	case endpoint != "" || driver == "amazons3":
+		note := ""
+		if endpoint == "" {
+			endpoint, note = "s3.amazonaws.com", "MM_FILESETTINGS_AMAZONS3ENDPOINT not set, default assumed"
+		}
+		scheme := "https"
+		if strings.EqualFold(env["MM_FILESETTINGS_AMAZONS3SSL"], "false") {
+			scheme = "http"
+		}
+		add("S3", scheme+"://"+endpoint, true, note)
+	case driver == "":
+		unknown("S3", "MM_FILESETTINGS_DRIVERNAME")
+	}
+
+	if es := env["MM_ELASTICSEARCHSETTINGS_CONNECTIONURL"]; es != "" {
+		add("Elasticsearch", es, true, "")
+	}
+
+	for _, raw := range extra {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		name, value, found := strings.Cut(raw, "=")
+		if !found {
+			name, value = raw, raw
+		}
+		target, err := parseProxyTarget(name, value, true)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// GetMattermostProxyEvaluation reads the proxy variables of the Mattermost process and
+// evaluates, for each target, whether Go's httpproxy rules would send it through a proxy.
+// Without any proxy variables every target is direct.
+func GetMattermostProxyEvaluation(selector *processSelector, extra []string) (map[string]string, []proxyEvaluation, error) {
+	env, err := GetMattermostProcessEnviron(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets, err := mattermostProxyTargets(env, extra)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxyFunc := proxyConfigFromEnv(env).ProxyFunc()
+	evaluations := make([]proxyEvaluation, 0, len(targets))
+	for _, target := range targets {
+		if target.url == nil {
+			evaluations = append(evaluations, proxyEvaluation{target: target})
+			continue
+		}
+		proxy, err := proxyFunc(target.url)
+		evaluations = append(evaluations, proxyEvaluation{target: target, proxy: proxy, err: err})
+	}
+
+	return env, evaluations, nil
+}
+
+// PrintMattermostProxyEvaluation prints the Mattermost process's proxy variables and
+// which of its destinations would be proxied.
+func PrintMattermostProxyEvaluation(selector *processSelector, extra []string) error {
+	env, evaluations, err := GetMattermostProxyEvaluation(selector, extra)
+	if err != nil {
+		return err
+	}
+
+	vars := table.NewWriter()
+	vars.SetOutputMirror(os.Stdout)
+	vars.AppendHeader(table.Row{"Variable", "Value"})
+	for _, name := range proxyEnvNames {
+		value, ok := env[name]
+		if !ok {
+			value = text.Colors{text.Faint}.Sprint("(unset)")
+		}
+		vars.AppendRow(table.Row{name, value})
+	}
+	vars.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprint("Mattermost Process Proxy Variables:"))
+	vars.Render()
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Target", "Address", "Proxy", "Note"})
+
+	for _, evaluation := range evaluations {
+		if evaluation.target.url == nil {
+			t.AppendRow(table.Row{
+				evaluation.target.name,
+				text.Colors{text.Faint}.Sprint("unknown"),
+				text.Colors{text.Faint}.Sprint("n/a"),
+				evaluation.target.note,
+			})
+			continue
+		}
+
+		proxy := text.Colors{text.Bold, text.FgGreen}.Sprint("direct")
+		note := evaluation.target.note
+		switch {
+		case evaluation.err != nil:
+			proxy = text.Colors{text.Bold, text.FgRed}.Sprint("error")
+			note = evaluation.err.Error()
+		case evaluation.proxy != nil:
+			proxy = text.Colors{text.Bold, text.FgYellow}.Sprintf("%s://%s", evaluation.proxy.Scheme, evaluation.proxy.Host)
+		}
+		address := evaluation.target.url.Redacted()
+		if !evaluation.target.viaHTTP {
+			address = evaluation.target.url.Host
+			if evaluation.proxy != nil {
+				note = strings.TrimPrefix(note+"; matches the proxy rules, but Mattermost does not dial it over HTTP", "; ")
+			}
+		}
+
+		t.AppendRow(table.Row{
+			evaluation.target.name,
+			address,
+			proxy,
+			note,
+		})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprint("Proxy Evaluation:"))
+	t.Render()
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+// proxyProtocolV2Signature starts every PROXY protocol v2 header.
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyProtocolV2Command = 0x21 // version 2, PROXY command
+	proxyProtocolV2TCP4    = 0x11 // AF_INET, STREAM
+	proxyProtocolV2TCP6    = 0x21 // AF_INET6, STREAM
+)
+
+// buildProxyProtocolHeader builds a HAProxy PROXY protocol header announcing a TCP
+// connection from src to dst, in the text (v1) or binary (v2) format.
+func buildProxyProtocolHeader(version string, src, dst netip.AddrPort) ([]byte, error) {
+	srcAddr, dstAddr := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcAddr.Is4() != dstAddr.Is4() {
+		return nil, fmt.Errorf("PROXY header source %s and destination %s must be the same address family", src, dst)
+	}
+
+	switch version {
+	case "v1":
+		family := "TCP4"
+		if srcAddr.Is6() {
+			family = "TCP6"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcAddr, dstAddr, src.Port(), dst.Port()), nil
+
+	case "v2":
+		header := append([]byte(nil), proxyProtocolV2Signature...)
+		var addrs []byte
+		if srcAddr.Is4() {
+			header = append(header, proxyProtocolV2Command, proxyProtocolV2TCP4)
+			s, d := srcAddr.As4(), dstAddr.As4()
+			addrs = append(append(addrs, s[:]...), d[:]...)
+		} else {
+			header = append(header, proxyProtocolV2Command, proxyProtocolV2TCP6)
+			s, d := srcAddr.As16(), dstAddr.As16()
+			addrs = append(append(addrs, s[:]...), d[:]...)
+		}
+		addrs = binary.BigEndian.AppendUint16(addrs, src.Port())
+		addrs = binary.BigEndian.AppendUint16(addrs, dst.Port())
+
+		header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+		return append(header, addrs...), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version '%s' (use v1 or v2)", version)
+	}
+}
+
+// writeProxyProtocolHeader sends the PROXY header on a freshly established connection.
+// Unset source and destination default to the connection's own endpoints.
+func writeProxyProtocolHeader(conn net.Conn, version string, src, dst netip.AddrPort) error {
+	if !src.IsValid() {
+		src = addrPortOf(conn.LocalAddr())
+	}
+	if !dst.IsValid() {
+		dst = addrPortOf(conn.RemoteAddr())
+	}
+	if !src.IsValid() || !dst.IsValid() {
+		return fmt.Errorf("cannot determine PROXY header addresses; set -proxy-protocol-src and -proxy-protocol-dst")
+	}
+
+	header, err := buildProxyProtocolHeader(version, src, dst)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("failed to send PROXY %s header: %w", version, err)
+	}
+	return nil
+}
+
+// resolveProxyProtocolDst resolves the target address host:port for the PROXY header
+// destination, preferring an address of the same family as the source.
+func resolveProxyProtocolDst(ctx context.Context, address string, preferIPv4 bool) (netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid PROXY header destination '%s': %w", address, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid PROXY header destination port '%s'", portStr)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("cannot resolve %s for the PROXY header destination, set -proxy-protocol-dst: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if addr.Unmap().Is4() == preferIPv4 {
+			return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+		}
+	}
+	if len(addrs) == 0 {
+		return netip.AddrPort{}, fmt.Errorf("no addresses for %s, set -proxy-protocol-dst", host)
+	}
+	return netip.AddrPortFrom(addrs[0].Unmap(), uint16(port)), nil
+}
+
+// addrPortOf converts a TCP address to a netip.AddrPort, or returns the zero value.
+func addrPortOf(addr net.Addr) netip.AddrPort {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.AddrPort()
+	}
+	return netip.AddrPort{}
+}
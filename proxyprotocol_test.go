@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestBuildProxyProtocolHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		src     string
+		dst     string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			// Example from section 2.1 of the PROXY protocol specification.
+			name:    "v1 tcp4",
+			version: "v1",
+			src:     "192.168.0.1:56324",
+			dst:     "192.168.0.11:443",
+			want:    []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+		},
+		{
+			// The longest TCP4 line is 56 bytes.
+			name:    "v1 tcp4 worst case",
+			version: "v1",
+			src:     "255.255.255.255:65535",
+			dst:     "255.255.255.255:65535",
+			want:    []byte("PROXY TCP4 255.255.255.255 255.255.255.255 65535 65535\r\n"),
+		},
+		{
+			name:    "v1 tcp6",
+			version: "v1",
+			src:     "[2001:db8::1]:51000",
+			dst:     "[2001:db8::2]:443",
+			want:    []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51000 443\r\n"),
+		},
+		{
+			name:    "v1 ipv4-mapped addresses are announced as tcp4",
+			version: "v1",
+			src:     "[::ffff:203.0.113.7]:51000",
+			dst:     "[::ffff:198.51.100.10]:443",
+			want:    []byte("PROXY TCP4 203.0.113.7 198.51.100.10 51000 443\r\n"),
+		},
+		{
+			// 12-byte signature, version 2 PROXY command, AF_INET STREAM, 12 bytes of
+			// addresses: source and destination address, then source and destination port.
+			name:    "v2 tcp4",
+			version: "v2",
+			src:     "203.0.113.7:51000",
+			dst:     "198.51.100.10:443",
+			want: append(append([]byte(nil), proxyProtocolV2Signature...),
+				0x21, 0x11, 0x00, 0x0c,
+				203, 0, 113, 7,
+				198, 51, 100, 10,
+				0xc7, 0x38,
+				0x01, 0xbb,
+			),
+		},
+		{
+			// AF_INET6 STREAM with 36 bytes of addresses.
+			name:    "v2 tcp6",
+			version: "v2",
+			src:     "[2001:db8::1]:51000",
+			dst:     "[2001:db8::2]:443",
+			want: append(append([]byte(nil), proxyProtocolV2Signature...),
+				0x21, 0x21, 0x00, 0x24,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02,
+				0xc7, 0x38,
+				0x01, 0xbb,
+			),
+		},
+		{
+			name:    "mixed address families",
+			version: "v2",
+			src:     "203.0.113.7:51000",
+			dst:     "[2001:db8::2]:443",
+			wantErr: true,
+		},
+		{
+			name:    "unknown version",
+			version: "v3",
+			src:     "203.0.113.7:51000",
+			dst:     "198.51.100.10:443",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildProxyProtocolHeader(tt.version, netip.MustParseAddrPort(tt.src), netip.MustParseAddrPort(tt.dst))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildProxyProtocolHeader = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildProxyProtocolHeader: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("buildProxyProtocolHeader =\n% x\nwant\n% x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteProxyProtocolHeaderDefaultsToConnectionEndpoints(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := writeProxyProtocolHeader(conn, "v1", netip.AddrPort{}, netip.AddrPort{}); err != nil {
+		t.Fatalf("writeProxyProtocolHeader: %v", err)
+	}
+
+	local, remote := addrPortOf(conn.LocalAddr()), addrPortOf(conn.RemoteAddr())
+	want := fmt.Sprintf("PROXY TCP4 127.0.0.1 127.0.0.1 %d %d\r\n", local.Port(), remote.Port())
+	if got := <-received; got != want {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestResolveProxyProtocolDst(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    string
+		preferIPv4 bool
+		want       string
+		wantErr    bool
+	}{
+		{name: "ipv4 literal", address: "192.0.2.10:443", preferIPv4: true, want: "192.0.2.10:443"},
+		{name: "ipv6 literal", address: "[2001:db8::10]:8065", want: "[2001:db8::10]:8065"},
+		{name: "other family than preferred", address: "192.0.2.10:443", want: "192.0.2.10:443"},
+		{name: "missing port", address: "192.0.2.10", wantErr: true},
+		{name: "port out of range", address: "192.0.2.10:65536", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveProxyProtocolDst(context.Background(), tt.address, tt.preferIPv4)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveProxyProtocolDst = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveProxyProtocolDst: %v", err)
+			}
+			if want := netip.MustParseAddrPort(tt.want); got != want {
+				t.Errorf("resolveProxyProtocolDst = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/sys/unix"
+)
+
+// routeMetricNames maps RTAX_* identifiers from RTA_METRICS to display names.
+var routeMetricNames = map[uint16]string{
+	unix.RTAX_LOCK:       "lock",
+	unix.RTAX_MTU:        "mtu",
+	unix.RTAX_WINDOW:     "window",
+	unix.RTAX_RTT:        "rtt",
+	unix.RTAX_RTTVAR:     "rttvar",
+	unix.RTAX_SSTHRESH:   "ssthresh",
+	unix.RTAX_CWND:       "cwnd",
+	unix.RTAX_ADVMSS:     "advmss",
+	unix.RTAX_REORDERING: "reordering",
+	unix.RTAX_HOPLIMIT:   "hoplimit",
+	unix.RTAX_INITCWND:   "initcwnd",
+	unix.RTAX_FEATURES:   "features",
+	unix.RTAX_RTO_MIN:    "rto_min",
+	unix.RTAX_INITRWND:   "initrwnd",
+	unix.RTAX_QUICKACK:   "quickack",
+}
+
+// routeTypeNames maps RTN_* route types to display names.
+var routeTypeNames = map[uint8]string{
+	unix.RTN_UNICAST:     "unicast",
+	unix.RTN_LOCAL:       "local",
+	unix.RTN_BROADCAST:   "broadcast",
+	unix.RTN_ANYCAST:     "anycast",
+	unix.RTN_MULTICAST:   "multicast",
+	unix.RTN_BLACKHOLE:   "blackhole",
+	unix.RTN_UNREACHABLE: "unreachable",
+	unix.RTN_PROHIBIT:    "prohibit",
+}
+
+// routeInfo describes the route the kernel selected for a destination.
+type routeInfo struct {
+	destination   net.IP
+	routeType     string
+	ifaceName     string
+	ifaceIndex    int
+	gateway       net.IP
+	source        net.IP
+	table         uint32
+	priority      uint32
+	mtu           int
+	mtuFromIface  bool
+	metrics       map[string]uint32
+	congestionAlg string
+}
+
+// resolveRouteDestination returns the IP address to look up a route for. Addresses of
+// the source's family are preferred, like a dial from that source would; without a
+// source IPv4 is preferred.
+func resolveRouteDestination(host string, src net.IP) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	wantIPv4 := src == nil || src.To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == wantIPv4 {
+			return ip, nil
+		}
+	}
+	return ips[0], nil
+}
+
+// ipFamilyName returns "IPv4" or "IPv6" for ip.
+func ipFamilyName(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// netlinkAttr encodes a single rtattr with native byte order and 4-byte alignment.
+func netlinkAttr(typ uint16, value []byte) []byte {
+	length := unix.SizeofRtAttr + len(value)
+	attr := make([]byte, (length+unix.RTA_ALIGNTO-1) & ^(unix.RTA_ALIGNTO-1))
+	binary.NativeEndian.PutUint16(attr[0:2], uint16(length))
+	binary.NativeEndian.PutUint16(attr[2:4], typ)
+	copy(attr[unix.SizeofRtAttr:], value)
+	return attr
+}
+
+// GetRoute asks the kernel via netlink RTM_GETROUTE which route it would use to reach
+// host, like `ip route get`. A source address and output interface narrow the lookup
+// the same way -bind and -interface constrain the probes.
+func GetRoute(host, bindIP, iface string) (*routeInfo, error) {
+	var src net.IP
+	if bindIP != "" {
+		if src = net.ParseIP(bindIP); src == nil {
+			return nil, fmt.Errorf("invalid bind address '%s'", bindIP)
+		}
+	}
+
+	dst, err := resolveRouteDestination(host, src)
+	if err != nil {
+		return nil, err
+	}
+	// The kernel would read a mismatched RTA_SRC with the destination's address length.
+	if src != nil && ipFamilyName(src) != ipFamilyName(dst) {
+		return nil, fmt.Errorf("%w: -bind %s is %s, %s is %s", errBindFamilyMismatch, src, ipFamilyName(src), dst, ipFamilyName(dst))
+	}
+
+	family := unix.AF_INET
+	addrLen := 32
+	raw := dst.To4()
+	if raw == nil {
+		family = unix.AF_INET6
+		addrLen = 128
+		raw = dst.To16()
+	}
+
+	body := make([]byte, unix.SizeofRtMsg)
+	body[0] = byte(family)
+	body[1] = byte(addrLen)
+	binary.NativeEndian.PutUint32(body[8:12], unix.RTM_F_LOOKUP_TABLE)
+	body = append(body, netlinkAttr(unix.RTA_DST, raw)...)
+
+	if src != nil {
+		if family == unix.AF_INET {
+			src = src.To4()
+		} else {
+			src = src.To16()
+		}
+		body[2] = byte(len(src) * 8)
+		body = append(body, netlinkAttr(unix.RTA_SRC, src)...)
+	}
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interface '%s': %w", iface, err)
+		}
+		index := make([]byte, 4)
+		binary.NativeEndian.PutUint32(index, uint32(ifi.Index))
+		body = append(body, netlinkAttr(unix.RTA_OIF, index)...)
+	}
+
+	msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(body))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(body)))
+	binary.NativeEndian.PutUint16(msg[4:6], unix.RTM_GETROUTE)
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(msg[8:12], 1)
+	msg = append(msg, body...)
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to send RTM_GETROUTE: %w", err)
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netlink response: %w", err)
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse netlink response: %w", err)
+	}
+
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case unix.NLMSG_ERROR:
+			if len(m.Data) >= 4 {
+				if errno := int32(binary.NativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+					return nil, fmt.Errorf("no route to %s: %w", dst, syscall.Errno(-errno))
+				}
+			}
+		case unix.RTM_NEWROUTE:
+			return parseRouteMessage(dst, m)
+		}
+	}
+
+	return nil, fmt.Errorf("kernel returned no route for %s", dst)
+}
+
+// parseRouteMessage decodes an RTM_NEWROUTE reply.
+func parseRouteMessage(dst net.IP, m syscall.NetlinkMessage) (*routeInfo, error) {
+	if len(m.Data) < unix.SizeofRtMsg {
+		return nil, fmt.Errorf("short route message")
+	}
+
+	info := &routeInfo{
+		destination: dst,
+		table:       uint32(m.Data[4]),
+		metrics:     make(map[string]uint32),
+	}
+	info.routeType = routeTypeNames[m.Data[7]]
+	if info.routeType == "" {
+		info.routeType = fmt.Sprintf("type %d", m.Data[7])
+	}
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse route attributes: %w", err)
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_OIF:
+			info.ifaceIndex = int(binary.NativeEndian.Uint32(attr.Value))
+		case unix.RTA_GATEWAY:
+			info.gateway = net.IP(attr.Value)
+		case unix.RTA_PREFSRC:
+			info.source = net.IP(attr.Value)
+		case unix.RTA_TABLE:
+			info.table = binary.NativeEndian.Uint32(attr.Value)
+		case unix.RTA_PRIORITY:
+			info.priority = binary.NativeEndian.Uint32(attr.Value)
+		case unix.RTA_METRICS:
+			parseRouteMetrics(info, attr.Value)
+		}
+	}
+
+	if info.ifaceIndex != 0 {
+		if ifi, err := net.InterfaceByIndex(info.ifaceIndex); err == nil {
+			info.ifaceName = ifi.Name
+			if info.mtu == 0 {
+				info.mtu = ifi.MTU
+				info.mtuFromIface = true
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// parseRouteMetrics decodes the nested RTAX_* attributes of RTA_METRICS.
+func parseRouteMetrics(info *routeInfo, b []byte) {
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		typ := binary.NativeEndian.Uint16(b[2:4])
+		if length < unix.SizeofRtAttr || length > len(b) {
+			return
+		}
+		value := b[unix.SizeofRtAttr:length]
+
+		switch {
+		case typ == unix.RTAX_CC_ALGO:
+			// The kernel puts the name with its NUL terminator.
+			info.congestionAlg = strings.TrimRight(string(value), "\x00")
+		case len(value) >= 4:
+			v := binary.NativeEndian.Uint32(value)
+			if typ == unix.RTAX_MTU {
+				info.mtu = int(v)
+			}
+			name, ok := routeMetricNames[typ]
+			if !ok {
+				name = fmt.Sprintf("metric %d", typ)
+			}
+			info.metrics[name] = v
+		}
+
+		aligned := (length + unix.RTA_ALIGNTO - 1) & ^(unix.RTA_ALIGNTO - 1)
+		if aligned > len(b) {
+			return
+		}
+		b = b[aligned:]
+	}
+}
+
+// RouteSummary returns a one-line description of the kernel's route to host, like the
+// first line of `ip route get`.
+func RouteSummary(host, bindIP, iface string) (string, error) {
+	info, err := GetRoute(host, bindIP, iface)
+	if err != nil {
+		return "", err
+	}
+
+	summary := fmt.Sprintf("%s %s dev %s", info.routeType, info.destination, info.ifaceName)
+	if info.gateway != nil {
+		summary += " via " + info.gateway.String()
+	}
+	if info.source != nil {
+		summary += " src " + info.source.String()
+	}
+	return summary + fmt.Sprintf(" mtu %d", info.mtu), nil
+}
+
+// PrintRoute prints the kernel's route to host as a table.
+func PrintRoute(host, bindIP, iface string) error {
+	info, err := GetRoute(host, bindIP, iface)
+	if err != nil {
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Field", "Value"})
+
+	t.AppendRow(table.Row{"Destination", info.destination})
+	t.AppendRow(table.Row{"Type", info.routeType})
+	t.AppendRow(table.Row{"Interface", fmt.Sprintf("%s (index %d)", info.ifaceName, info.ifaceIndex)})
+
+	gateway := "none (directly connected)"
+	if info.gateway != nil {
+		gateway = info.gateway.String()
+	}
+	t.AppendRow(table.Row{"Gateway", gateway})
+
+	source := text.Colors{text.Bold, text.FgRed}.Sprint("none")
+	if info.source != nil {
+		source = info.source.String()
+	}
+	t.AppendRow(table.Row{"Source IP", source})
+
+	mtu := fmt.Sprintf("%d", info.mtu)
+	if info.mtuFromIface {
+		mtu += " (interface)"
+	}
+	t.AppendRow(table.Row{"MTU", mtu})
+	t.AppendRow(table.Row{"Table", info.table})
+	t.AppendRow(table.Row{"Metric", info.priority})
+
+	names := make([]string, 0, len(info.metrics))
+	for name := range info.metrics {
+		if name != "mtu" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.AppendRow(table.Row{"Route " + name, info.metrics[name]})
+	}
+	if info.congestionAlg != "" {
+		t.AppendRow(table.Row{"Route congctl", info.congestionAlg})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Route to %s:", host))
+	t.Render()
+
+	return nil
+}
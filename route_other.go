@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// PrintRoute is not available outside Linux, where netlink is used for the lookup.
+func PrintRoute(host, bindIP, iface string) error {
+	return fmt.Errorf("route lookup is %w", errUnsupportedPlatform)
+}
+
+// RouteSummary is not available outside Linux, where netlink is used for the lookup.
+func RouteSummary(host, bindIP, iface string) (string, error) {
+	return "", fmt.Errorf("route lookup is %w", errUnsupportedPlatform)
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// routeMetric encodes a 32-bit RTAX_* attribute.
+func routeMetric(typ uint16, value uint32) []byte {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, value)
+	return netlinkAttr(typ, b)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+func TestParseRouteMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		attrs       []byte
+		wantMetrics map[string]uint32
+		wantMTU     int
+		wantCC      string
+	}{
+		{name: "empty", attrs: nil, wantMetrics: map[string]uint32{}},
+		{
+			name:        "mtu and advmss",
+			attrs:       concat(routeMetric(unix.RTAX_MTU, 1400), routeMetric(unix.RTAX_ADVMSS, 1360)),
+			wantMetrics: map[string]uint32{"mtu": 1400, "advmss": 1360},
+			wantMTU:     1400,
+		},
+		{
+			// "cubic" and its NUL take 6 bytes, so the next attribute starts after padding.
+			name:        "padded congestion control",
+			attrs:       concat(routeMetric(unix.RTAX_LOCK, 1<<unix.RTAX_MTU), netlinkAttr(unix.RTAX_CC_ALGO, []byte("cubic\x00")), routeMetric(unix.RTAX_INITCWND, 10)),
+			wantMetrics: map[string]uint32{"lock": 1 << unix.RTAX_MTU, "initcwnd": 10},
+			wantCC:      "cubic",
+		},
+		{
+			name:        "congestion control without terminator",
+			attrs:       netlinkAttr(unix.RTAX_CC_ALGO, []byte("bbr")),
+			wantMetrics: map[string]uint32{},
+			wantCC:      "bbr",
+		},
+		{
+			name:        "unknown metric",
+			attrs:       routeMetric(99, 7),
+			wantMetrics: map[string]uint32{"metric 99": 7},
+		},
+		{
+			name:        "short value is skipped",
+			attrs:       concat(netlinkAttr(unix.RTAX_RTT, []byte{1, 2}), routeMetric(unix.RTAX_HOPLIMIT, 64)),
+			wantMetrics: map[string]uint32{"hoplimit": 64},
+		},
+		{
+			name:        "truncated attribute stops parsing",
+			attrs:       concat(routeMetric(unix.RTAX_WINDOW, 65535), routeMetric(unix.RTAX_SSTHRESH, 20)[:6]),
+			wantMetrics: map[string]uint32{"window": 65535},
+		},
+		{
+			name:        "length below header stops parsing",
+			attrs:       []byte{2, 0, 2, 0, 0, 0, 0, 0},
+			wantMetrics: map[string]uint32{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &routeInfo{metrics: make(map[string]uint32)}
+			parseRouteMetrics(info, tt.attrs)
+			if !reflect.DeepEqual(info.metrics, tt.wantMetrics) {
+				t.Errorf("metrics = %v, want %v", info.metrics, tt.wantMetrics)
+			}
+			if info.mtu != tt.wantMTU {
+				t.Errorf("mtu = %d, want %d", info.mtu, tt.wantMTU)
+			}
+			if info.congestionAlg != tt.wantCC {
+				t.Errorf("congestionAlg = %q, want %q", info.congestionAlg, tt.wantCC)
+			}
+		})
+	}
+}
+
+func TestGetRouteBindFamilyMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		bindIP string
+	}{
+		{name: "ipv6 bind, ipv4 destination", host: "192.0.2.10", bindIP: "2001:db8::5"},
+		{name: "ipv4 bind, ipv6 destination", host: "2001:db8::10", bindIP: "10.20.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetRoute(tt.host, tt.bindIP, "")
+			if !errors.Is(err, errBindFamilyMismatch) {
+				t.Fatalf("GetRoute error = %v, want %v", err, errBindFamilyMismatch)
+			}
+			if code := exitCode(err, exitProbeFailed); code != exitUsage {
+				t.Errorf("exitCode = %d, want %d", code, exitUsage)
+			}
+		})
+	}
+
+	if _, err := GetRoute("192.0.2.10", "not-an-ip", ""); err == nil || errors.Is(err, errBindFamilyMismatch) {
+		t.Errorf("GetRoute with invalid bind address error = %v", err)
+	}
+}
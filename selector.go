@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultProcessName is the comm of the Mattermost server when no selector is given.
+	defaultProcessName = "mattermost"
+	// processCmdlineWidth truncates command lines when listing candidate processes.
+	processCmdlineWidth = 100
+)
+
+// processSelector chooses the Mattermost process to inspect. Without any selector the
+// process whose comm is exactly "mattermost" is used; -cgroup alone narrows that down
+// to one cgroup.
+type processSelector struct {
+	pid    int
+	name   *regexp.Regexp
+	cgroup string
+}
+
+// newProcessSelector validates the -pid, -process-name and -cgroup selectors.
+func newProcessSelector(pid int, namePattern, cgroup string) (*processSelector, error) {
+	selector := &processSelector{pid: pid, cgroup: cgroup}
+	if pid < 0 {
+		return nil, fmt.Errorf("invalid PID %d", pid)
+	}
+	if pid != 0 && (namePattern != "" || cgroup != "") {
+		return nil, fmt.Errorf("-pid cannot be combined with -process-name or -cgroup")
+	}
+	if namePattern != "" {
+		re, err := regexp.Compile(namePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid process name pattern '%s': %w", namePattern, err)
+		}
+		selector.name = re
+	}
+	return selector, nil
+}
+
+// explicit reports whether the user selected the process instead of relying on the default.
+func (s *processSelector) explicit() bool {
+	return s != nil && (s.pid != 0 || s.name != nil || s.cgroup != "")
+}
+
+// matches reports whether a process with the given comm, cmdline, executable and
+// cgroup paths is selected. Name and cgroup selectors must both match when given;
+// without a name the comm must be "mattermost", so that plugins and other processes
+// in the same cgroup are not selected.
+func (s *processSelector) matches(comm, cmdline, exe string, cgroups []string) bool {
+	if !s.explicit() {
+		return comm == defaultProcessName
+	}
+	if s.name == nil && comm != defaultProcessName {
+		return false
+	}
+	if s.name != nil && !s.name.MatchString(comm) && !s.name.MatchString(cmdline) && !s.name.MatchString(exe) {
+		return false
+	}
+	if s.cgroup != "" {
+		found := false
+		for _, path := range cgroups {
+			if strings.Contains(path, s.cgroup) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the selector for error messages.
+func (s *processSelector) String() string {
+	if s.pid != 0 {
+		return fmt.Sprintf("PID %d", s.pid)
+	}
+
+	parts := []string{fmt.Sprintf("comm '%s'", defaultProcessName)}
+	if s.name != nil {
+		parts[0] = fmt.Sprintf("name /%s/", s.name)
+	}
+	if s.cgroup != "" {
+		parts = append(parts, fmt.Sprintf("cgroup '%s'", s.cgroup))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// processMatch is a candidate process found by a selector.
+type processMatch struct {
+	pid     int
+	started time.Time
+	user    string
+	cmdline string
+}
+
+// multipleProcessesError is returned when a selector matches more than one process,
+// so that one is never picked silently.
+type multipleProcessesError struct {
+	selector *processSelector
+	matches  []processMatch
+}
+
+func (e *multipleProcessesError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d processes match %s, select one with -pid, -process-name or -cgroup:", len(e.matches), e.selector)
+	for _, match := range e.matches {
+		cmdline := match.cmdline
+		if len(cmdline) > processCmdlineWidth {
+			cmdline = cmdline[:processCmdlineWidth] + "..."
+		}
+		fmt.Fprintf(&b, "\n  PID %-8d started %s  user %-12s %s", match.pid, match.started.Format(time.DateTime), match.user, cmdline)
+	}
+	return b.String()
+}
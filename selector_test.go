@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestNewProcessSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		pid     int
+		pattern string
+		cgroup  string
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "pid", pid: 4242},
+		{name: "name and cgroup", pattern: "mattermost", cgroup: "mattermost.service"},
+		{name: "negative pid", pid: -1, wantErr: true},
+		{name: "invalid pattern", pattern: "(", wantErr: true},
+		{name: "pid with name", pid: 4242, pattern: "mattermost", wantErr: true},
+		{name: "pid with cgroup", pid: 4242, cgroup: "mattermost.service", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newProcessSelector(tt.pid, tt.pattern, tt.cgroup)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newProcessSelector error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessSelectorMatches(t *testing.T) {
+	const (
+		serverExe = "/opt/mattermost/bin/mattermost"
+		pluginExe = "/opt/mattermost/plugins/com.mattermost.calls/server/dist/plugin-linux-amd64"
+		unit      = "/system.slice/mattermost.service"
+	)
+
+	tests := []struct {
+		name    string
+		pattern string
+		cgroup  string
+		comm    string
+		exe     string
+		cgroups []string
+		want    bool
+	}{
+		{name: "default server", comm: "mattermost", exe: serverExe, want: true},
+		{name: "default plugin", comm: "plugin-linux-am", exe: pluginExe},
+		{name: "cgroup server", cgroup: "mattermost.service", comm: "mattermost", exe: serverExe, cgroups: []string{unit}, want: true},
+		{name: "cgroup plugin", cgroup: "mattermost.service", comm: "plugin-linux-am", exe: pluginExe, cgroups: []string{unit}},
+		{name: "cgroup kernel thread", cgroup: "/", comm: "kworker/0:1", cgroups: []string{"/"}},
+		{name: "cgroup elsewhere", cgroup: "mattermost.service", comm: "mattermost", exe: serverExe, cgroups: []string{"/user.slice"}},
+		{name: "name renamed binary", pattern: "/opt/mattermost/bin/", comm: "mm-staging", exe: "/opt/mattermost/bin/mm-staging", want: true},
+		{name: "name and cgroup", pattern: "mm-staging", cgroup: "mattermost.service", comm: "mm-staging", cgroups: []string{unit}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := newProcessSelector(0, tt.pattern, tt.cgroup)
+			if err != nil {
+				t.Fatalf("newProcessSelector: %v", err)
+			}
+			if got := selector.matches(tt.comm, tt.exe, tt.exe, tt.cgroups); got != tt.want {
+				t.Errorf("matches(%q, %q) = %v, want %v", tt.comm, tt.exe, got, tt.want)
+			}
+		})
+	}
+}
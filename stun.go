@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// STUN message types and attributes (RFC 5389).
+const (
+	stunMagicCookie = 0x2112A442
+	stunHeaderSize  = 20
+
+	stunBindingRequest  = 0x0001
+	stunBindingSuccess  = 0x0101
+	stunBindingError    = 0x0111
+	stunDefaultPort     = 3478
+	stunDefaultTLSPort  = 5349
+	stunInitialRTO      = 500 * time.Millisecond
+	stunMaxMessageBytes = 1500
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrUsername         = 0x0006
+	stunAttrMessageIntegrity = 0x0008
+	stunAttrErrorCode        = 0x0009
+	stunAttrRealm            = 0x0014
+	stunAttrNonce            = 0x0015
+	stunAttrXORMappedAddress = 0x0020
+	stunAttrSoftware         = 0x8022
+)
+
+// stunAttribute is a single type-length-value attribute of a STUN message.
+type stunAttribute struct {
+	typ   uint16
+	value []byte
+}
+
+// stunMessage is a decoded STUN message.
+type stunMessage struct {
+	typ        uint16
+	txID       [12]byte
+	attributes []stunAttribute
+}
+
+// stunTestResult contains information about a STUN binding test.
+type stunTestResult struct {
+	success     bool
+	transport   string
+	server      string
+	localAddr   string
+	reflexive   netip.AddrPort
+	xorMapped   bool
+	software    string
+	rtt         time.Duration
+	errorCode   int
+	errorReason string
+	err         error
+}
+
+// newStunMessage creates a message of the given type with a random transaction ID.
+func newStunMessage(typ uint16) (*stunMessage, error) {
+	m := &stunMessage{typ: typ}
+	if _, err := rand.Read(m.txID[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate transaction ID: %w", err)
+	}
+	return m, nil
+}
+
+// add appends an attribute to the message.
+func (m *stunMessage) add(typ uint16, value []byte) {
+	m.attributes = append(m.attributes, stunAttribute{typ: typ, value: value})
+}
+
+// get returns the value of the first attribute of the given type.
+func (m *stunMessage) get(typ uint16) ([]byte, bool) {
+	for _, attr := range m.attributes {
+		if attr.typ == typ {
+			return attr.value, true
+		}
+	}
+	return nil, false
+}
+
+// encode serializes the message, padding attributes to 4-byte boundaries.
+func (m *stunMessage) encode() []byte {
+	var body bytes.Buffer
+	for _, attr := range m.attributes {
+		var tl [4]byte
+		binary.BigEndian.PutUint16(tl[0:2], attr.typ)
+		binary.BigEndian.PutUint16(tl[2:4], uint16(len(attr.value)))
+		body.Write(tl[:])
+		body.Write(attr.value)
+		if pad := (4 - len(attr.value)%4) % 4; pad > 0 {
+			body.Write(make([]byte, pad))
+		}
+	}
+
+	out := make([]byte, stunHeaderSize, stunHeaderSize+body.Len())
+	binary.BigEndian.PutUint16(out[0:2], m.typ)
+	binary.BigEndian.PutUint16(out[2:4], uint16(body.Len()))
+	binary.BigEndian.PutUint32(out[4:8], stunMagicCookie)
+	copy(out[8:20], m.txID[:])
+	return append(out, body.Bytes()...)
+}
+
+// addMessageIntegrity appends a MESSAGE-INTEGRITY attribute computed with key over the
+// message as encoded so far (RFC 5389 section 15.4). It must be the last attribute added.
+func (m *stunMessage) addMessageIntegrity(key []byte) {
+	m.add(stunAttrMessageIntegrity, make([]byte, sha1.Size))
+	out := m.encode()
+
+	// The HMAC covers everything before the attribute, with the header length
+	// already accounting for it.
+	mac := hmac.New(sha1.New, key)
+	mac.Write(out[:len(out)-sha1.Size-4])
+	copy(m.attributes[len(m.attributes)-1].value, mac.Sum(nil))
+}
+
+// decodeStunMessage parses a STUN message from b.
+func decodeStunMessage(b []byte) (*stunMessage, error) {
+	if len(b) < stunHeaderSize {
+		return nil, fmt.Errorf("message too short: %d bytes", len(b))
+	}
+	if b[0]&0xc0 != 0 {
+		return nil, fmt.Errorf("not a STUN message")
+	}
+	if binary.BigEndian.Uint32(b[4:8]) != stunMagicCookie {
+		return nil, fmt.Errorf("invalid magic cookie 0x%08x", binary.BigEndian.Uint32(b[4:8]))
+	}
+
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if len(b) < stunHeaderSize+length {
+		return nil, fmt.Errorf("truncated message: header says %d bytes, got %d", length, len(b)-stunHeaderSize)
+	}
+
+	m := &stunMessage{typ: binary.BigEndian.Uint16(b[0:2])}
+	copy(m.txID[:], b[8:20])
+
+	body := b[stunHeaderSize : stunHeaderSize+length]
+	for len(body) >= 4 {
+		typ := binary.BigEndian.Uint16(body[0:2])
+		size := int(binary.BigEndian.Uint16(body[2:4]))
+		if len(body) < 4+size {
+			return nil, fmt.Errorf("truncated attribute 0x%04x", typ)
+		}
+		m.add(typ, body[4:4+size])
+
+		padded := 4 + size + (4-size%4)%4
+		if padded > len(body) {
+			break
+		}
+		body = body[padded:]
+	}
+
+	return m, nil
+}
+
+// decodeStunAddress parses a (XOR-)MAPPED-ADDRESS style attribute value.
+func decodeStunAddress(value []byte, xor bool, txID [12]byte) (netip.AddrPort, error) {
+	if len(value) < 4 {
+		return netip.AddrPort{}, fmt.Errorf("address attribute too short")
+	}
+
+	family := value[1]
+	port := binary.BigEndian.Uint16(value[2:4])
+	raw := append([]byte(nil), value[4:]...)
+
+	if xor {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+		copy(key[4:], txID[:])
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range raw {
+			if i < len(key) {
+				raw[i] ^= key[i]
+			}
+		}
+	}
+
+	switch {
+	case family == 0x01 && len(raw) == 4:
+		return netip.AddrPortFrom(netip.AddrFrom4([4]byte(raw)), port), nil
+	case family == 0x02 && len(raw) == 16:
+		return netip.AddrPortFrom(netip.AddrFrom16([16]byte(raw)), port), nil
+	default:
+		return netip.AddrPort{}, fmt.Errorf("unsupported address family 0x%02x", family)
+	}
+}
+
+// decodeStunError parses an ERROR-CODE attribute value.
+func decodeStunError(value []byte) (int, string) {
+	if len(value) < 4 {
+		return 0, ""
+	}
+	code := int(value[2]&0x07)*100 + int(value[3])
+	return code, string(value[4:])
+}
+
+// dialStun opens a connection to a STUN server over the given transport.
+func dialStun(host string, port int, transport string, dialer *probeDialer) (net.Conn, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	switch transport {
+	case "udp", "tcp":
+		conn, err := dialer.Dial(transport, address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s over %s: %w", address, transport, err)
+		}
+		return conn, nil
+	case "tls":
+		conn, err := dialer.DialTLS("tcp", address, &tls.Config{ServerName: host})
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s over tls: %w", address, err)
+		}
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport '%s' (use udp, tcp or tls)", transport)
+	}
+}
+
+// stunRoundTrip sends req over conn and waits for the response with a matching transaction ID.
+// Over UDP the request is retransmitted with exponential backoff until the timeout expires;
+// stream transports rely on the transport for delivery and read a single framed message.
+func stunRoundTrip(conn net.Conn, transport string, req *stunMessage, timeout time.Duration) (*stunMessage, time.Duration, error) {
+	payload := req.encode()
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	if transport != "udp" {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, 0, fmt.Errorf("failed to set deadline: %w", err)
+		}
+		if _, err := conn.Write(payload); err != nil {
+			return nil, 0, fmt.Errorf("failed to send request: %w", err)
+		}
+
+		for {
+			header := make([]byte, stunHeaderSize)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return nil, 0, fmt.Errorf("failed to read response: %w", err)
+			}
+			msg := make([]byte, stunHeaderSize+int(binary.BigEndian.Uint16(header[2:4])))
+			copy(msg, header)
+			if _, err := io.ReadFull(conn, msg[stunHeaderSize:]); err != nil {
+				return nil, 0, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			resp, err := decodeStunMessage(msg)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid response: %w", err)
+			}
+			if resp.txID == req.txID {
+				return resp, time.Since(start), nil
+			}
+		}
+	}
+
+	buf := make([]byte, stunMaxMessageBytes)
+	rto := stunInitialRTO
+	for time.Now().Before(deadline) {
+		sent := time.Now()
+		if _, err := conn.Write(payload); err != nil {
+			return nil, 0, fmt.Errorf("failed to send request: %w", err)
+		}
+
+		wait := sent.Add(rto)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		for {
+			if err := conn.SetReadDeadline(wait); err != nil {
+				return nil, 0, fmt.Errorf("failed to set read deadline: %w", err)
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, 0, fmt.Errorf("failed to read response: %w", err)
+			}
+
+			resp, err := decodeStunMessage(buf[:n])
+			if err != nil || resp.txID != req.txID {
+				continue
+			}
+			return resp, time.Since(sent), nil
+		}
+		rto *= 2
+	}
+
+	return nil, 0, fmt.Errorf("no response within %v", timeout)
+}
+
+// testSTUNBinding sends an RFC 5389 Binding Request and reports the server-reflexive address.
+func testSTUNBinding(host string, port int, transport string, dialer *probeDialer) *stunTestResult {
+	result := &stunTestResult{
+		transport: transport,
+		server:    net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+
+	conn, err := dialStun(host, port, transport, dialer)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer conn.Close()
+	result.localAddr = conn.LocalAddr().String()
+
+	req, err := newStunMessage(stunBindingRequest)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	resp, rtt, err := stunRoundTrip(conn, transport, req, dialer.timeout)
+	if err != nil {
+		result.err = fmt.Errorf("STUN binding failed: %w", err)
+		return result
+	}
+	result.rtt = rtt
+
+	if software, ok := resp.get(stunAttrSoftware); ok {
+		result.software = string(software)
+	}
+
+	switch resp.typ {
+	case stunBindingSuccess:
+	case stunBindingError:
+		value, _ := resp.get(stunAttrErrorCode)
+		result.errorCode, result.errorReason = decodeStunError(value)
+		result.err = fmt.Errorf("server returned error %d %s", result.errorCode, result.errorReason)
+		return result
+	default:
+		result.err = fmt.Errorf("unexpected response type 0x%04x", resp.typ)
+		return result
+	}
+
+	if value, ok := resp.get(stunAttrXORMappedAddress); ok {
+		result.reflexive, err = decodeStunAddress(value, true, resp.txID)
+		result.xorMapped = true
+	} else if value, ok := resp.get(stunAttrMappedAddress); ok {
+		result.reflexive, err = decodeStunAddress(value, false, resp.txID)
+	} else {
+		err = fmt.Errorf("response has no mapped address")
+	}
+	if err != nil {
+		result.err = fmt.Errorf("invalid binding response: %w", err)
+		return result
+	}
+
+	result.success = true
+	return result
+}
+
+// printSTUNResult prints a colorized STUN test result and compares the reflexive
+// address with the expected ICE host override, if one is given.
+func printSTUNResult(result *stunTestResult, iceHostOverride string) {
+	if !result.success {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("STUN binding to %s (%s) failed: %v", result.server, result.transport, result.err))
+		printLikelyCause(result.err)
+		return
+	}
+
+	attr := "MAPPED-ADDRESS"
+	if result.xorMapped {
+		attr = "XOR-MAPPED-ADDRESS"
+	}
+
+	fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("STUN binding to %s (%s) successful", result.server, result.transport))
+	fmt.Printf("  Local Address: %s\n", result.localAddr)
+	fmt.Printf("  Reflexive Address: %s (%s)\n", result.reflexive, attr)
+	fmt.Printf("  RTT: %v\n", result.rtt)
+	if result.software != "" {
+		fmt.Printf("  Server Software: %s\n", result.software)
+	}
+
+	if iceHostOverride == "" {
+		return
+	}
+	if result.matchesHostOverride(iceHostOverride) {
+		fmt.Printf("  ICE Host Override: %s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("%s matches", iceHostOverride))
+	} else {
+		fmt.Printf("  ICE Host Override: %s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("%s does not match reflexive address %s", iceHostOverride, result.reflexive.Addr()))
+	}
+}
+
+// matchesHostOverride reports whether the reflexive address equals the given ICE host
+// override, which may be an IP address or a hostname resolving to it.
+func (r *stunTestResult) matchesHostOverride(override string) bool {
+	if !r.success {
+		return false
+	}
+	if addr, err := netip.ParseAddr(override); err == nil {
+		return addr.Unmap() == r.reflexive.Addr().Unmap()
+	}
+
+	addrs, err := net.LookupHost(override)
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if addr, err := netip.ParseAddr(a); err == nil && addr.Unmap() == r.reflexive.Addr().Unmap() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// mustHex decodes a hex dump, ignoring whitespace.
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatalf("invalid hex: %v", err)
+	}
+	return b
+}
+
+// rfc5769TxID is the transaction ID of the sample responses in RFC 5769 sections 2.2 and 2.3.
+var rfc5769TxID = [12]byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+
+func TestDecodeStunMessageRFC5769IPv4Response(t *testing.T) {
+	// RFC 5769 section 2.2, Sample IPv4 Response.
+	msg := mustHex(t, `
+		01 01 00 3c 21 12 a4 42 b7 e7 a7 01 bc 34 d6 86 fa 87 df ae
+		80 22 00 0b 74 65 73 74 20 76 65 63 74 6f 72 20
+		00 20 00 08 00 01 a1 47 e1 12 a6 43
+		00 08 00 14 2b 91 f5 99 fd 9e 90 c3 8c 74 89 f9 2a f9 ba 53 f0 6b e7 d7
+		80 28 00 04 c0 7d 4c 96`)
+
+	m, err := decodeStunMessage(msg)
+	if err != nil {
+		t.Fatalf("decodeStunMessage: %v", err)
+	}
+	if m.typ != stunBindingSuccess {
+		t.Errorf("type = 0x%04x, want 0x%04x", m.typ, stunBindingSuccess)
+	}
+	if m.txID != rfc5769TxID {
+		t.Errorf("txID = %x, want %x", m.txID, rfc5769TxID)
+	}
+	if len(m.attributes) != 4 {
+		t.Errorf("got %d attributes, want 4", len(m.attributes))
+	}
+	if software, _ := m.get(stunAttrSoftware); string(software) != "test vector" {
+		t.Errorf("SOFTWARE = %q, want %q", software, "test vector")
+	}
+
+	value, ok := m.get(stunAttrXORMappedAddress)
+	if !ok {
+		t.Fatal("XOR-MAPPED-ADDRESS missing")
+	}
+	addr, err := decodeStunAddress(value, true, m.txID)
+	if err != nil {
+		t.Fatalf("decodeStunAddress: %v", err)
+	}
+	if want := netip.MustParseAddrPort("192.0.2.1:32853"); addr != want {
+		t.Errorf("XOR-MAPPED-ADDRESS = %v, want %v", addr, want)
+	}
+}
+
+func TestDecodeStunAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		xor     bool
+		want    string
+		wantErr bool
+	}{
+		{
+			// RFC 5769 section 2.2.
+			name:  "xor ipv4",
+			value: "00 01 a1 47 e1 12 a6 43",
+			xor:   true,
+			want:  "192.0.2.1:32853",
+		},
+		{
+			// RFC 5769 section 2.3, Sample IPv6 Response.
+			name:  "xor ipv6",
+			value: "00 02 a1 47 01 13 a9 fa a5 d3 f1 79 bc 25 f4 b5 be d2 b9 d9",
+			xor:   true,
+			want:  "[2001:db8:1234:5678:11:2233:4455:6677]:32853",
+		},
+		{
+			name:  "plain ipv4",
+			value: "00 01 80 55 c0 00 02 01",
+			want:  "192.0.2.1:32853",
+		},
+		{
+			name:    "too short",
+			value:   "00 01 80",
+			wantErr: true,
+		},
+		{
+			name:    "unknown family",
+			value:   "00 03 80 55 c0 00 02 01",
+			wantErr: true,
+		},
+		{
+			name:    "ipv4 family with ipv6 length",
+			value:   "00 01 80 55 20 01 0d b8 00 00 00 00 00 00 00 00 00 00 00 01",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeStunAddress(mustHex(t, tt.value), tt.xor, rfc5769TxID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeStunAddress = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeStunAddress: %v", err)
+			}
+			if want := netip.MustParseAddrPort(tt.want); got != want {
+				t.Errorf("decodeStunAddress = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStunMessageEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		values [][]byte
+		length int
+	}{
+		{name: "no attributes", length: 0},
+		{name: "aligned", values: [][]byte{{1, 2, 3, 4}}, length: 8},
+		{name: "padded", values: [][]byte{[]byte("evtj:h6vY")}, length: 16},
+		{name: "empty value", values: [][]byte{{}}, length: 4},
+		{name: "several", values: [][]byte{{1}, {1, 2, 3, 4, 5, 6}, {1, 2}}, length: 8 + 12 + 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &stunMessage{typ: stunBindingRequest, txID: rfc5769TxID}
+			for i, value := range tt.values {
+				m.add(uint16(0x8000+i), value)
+			}
+
+			out := m.encode()
+			if len(out) != stunHeaderSize+tt.length {
+				t.Fatalf("encoded %d bytes, want %d", len(out), stunHeaderSize+tt.length)
+			}
+			if got := int(binary.BigEndian.Uint16(out[2:4])); got != tt.length {
+				t.Errorf("length field = %d, want %d", got, tt.length)
+			}
+			if !bytes.Equal(out[4:8], []byte{0x21, 0x12, 0xa4, 0x42}) {
+				t.Errorf("magic cookie = % x", out[4:8])
+			}
+
+			decoded, err := decodeStunMessage(out)
+			if err != nil {
+				t.Fatalf("decodeStunMessage: %v", err)
+			}
+			if decoded.typ != m.typ || decoded.txID != m.txID {
+				t.Errorf("header = 0x%04x %x, want 0x%04x %x", decoded.typ, decoded.txID, m.typ, m.txID)
+			}
+			if len(decoded.attributes) != len(m.attributes) {
+				t.Fatalf("decoded %d attributes, want %d", len(decoded.attributes), len(m.attributes))
+			}
+			for i, attr := range m.attributes {
+				if decoded.attributes[i].typ != attr.typ || !bytes.Equal(decoded.attributes[i].value, attr.value) {
+					t.Errorf("attribute %d = 0x%04x % x, want 0x%04x % x", i,
+						decoded.attributes[i].typ, decoded.attributes[i].value, attr.typ, attr.value)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeStunMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{name: "short header", msg: "00 01 00 00 21 12 a4 42"},
+		{name: "not stun", msg: "c0 01 00 00 21 12 a4 42 00 00 00 00 00 00 00 00 00 00 00 00"},
+		{name: "bad magic cookie", msg: "00 01 00 00 21 12 a4 43 00 00 00 00 00 00 00 00 00 00 00 00"},
+		{name: "truncated body", msg: "00 01 00 08 21 12 a4 42 00 00 00 00 00 00 00 00 00 00 00 00 80 22 00 04"},
+		{name: "truncated attribute", msg: "00 01 00 04 21 12 a4 42 00 00 00 00 00 00 00 00 00 00 00 00 80 22 00 08"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := decodeStunMessage(mustHex(t, tt.msg)); err == nil {
+				t.Errorf("decodeStunMessage = %+v, want error", m)
+			}
+		})
+	}
+}
+
+func TestDecodeStunError(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		code   int
+		reason string
+	}{
+		{name: "unauthorized", value: "00 00 04 01 " + hex.EncodeToString([]byte("Unauthorized")), code: 401, reason: "Unauthorized"},
+		{name: "stale nonce", value: "00 00 04 26 " + hex.EncodeToString([]byte("Stale Nonce")), code: 438, reason: "Stale Nonce"},
+		{name: "no reason", value: "00 00 03 00", code: 300},
+		{name: "too short", value: "00 00 04"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, reason := decodeStunError(mustHex(t, tt.value))
+			if code != tt.code || reason != tt.reason {
+				t.Errorf("decodeStunError = %d %q, want %d %q", code, reason, tt.code, tt.reason)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"runtime"
 	"sort"
 	"strconv"
@@ -51,6 +53,9 @@ type ulimitInfo struct {
 	hardLimit    uint64
 	expectedSoft uint64
 	expectedHard uint64
+	processPID   int
+	processSoft  uint64
+	processHard  uint64
 }
 
 // Default configurations
@@ -76,6 +81,12 @@ func defaultSysctlConfigs() []SysctlConfig {
 	}
 }
 
+// ulimitProcNames maps resources to their row label in /proc/<pid>/limits.
+var ulimitProcNames = map[int]string{
+	unix.RLIMIT_NOFILE: "Max open files",
+	unix.RLIMIT_NPROC:  "Max processes",
+}
+
 func defaultUlimitConfigs() []UlimitConfig {
 	return []UlimitConfig{
 		{unix.RLIMIT_NOFILE, "nofile", 65536, 65536},
@@ -208,7 +219,7 @@ func GetSysctls() ([]sysctlInfo, error) {
 }
 
 // GetUlimits retrieves and validates ulimit information
-func GetUlimits() ([]ulimitInfo, error) {
+func GetUlimits(selector *processSelector) ([]ulimitInfo, error) {
 	if runtime.GOOS != "linux" {
 		return nil, fmt.Errorf("ulimits only supported on Linux")
 	}
@@ -216,6 +227,24 @@ func GetUlimits() ([]ulimitInfo, error) {
 	configs := defaultUlimitConfigs()
 	results := make([]ulimitInfo, 0, len(configs))
 
+	// The server's limits come from systemd or the container runtime and often
+	// differ from the shell's, so they are read from /proc when the process is found.
+	var processLimits map[string][2]uint64
+	var processPID int
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	var multiple *multipleProcessesError
+	if err != nil && (selector.explicit() || errors.As(err, &multiple)) {
+		return nil, err
+	}
+	if err == nil {
+		processLimits, err = readProcessLimits(proc.PID)
+		if err != nil {
+			return nil, err
+		}
+		processPID = proc.PID
+	}
 
 	for _, config := range configs {
 		var limit unix.Rlimit
@@ -223,23 +252,82 @@ func GetUlimits() ([]ulimitInfo, error) {
 			continue
 		}
 
-		results = append(results, ulimitInfo{
+		info := ulimitInfo{
 			resourceName: config.Name,
 			softLimit:    limit.Cur,
 			hardLimit:    limit.Max,
 			expectedSoft: config.ExpectedSoft,
 			expectedHard: config.ExpectedHard,
-		})
+		}
+		if values, ok := processLimits[ulimitProcNames[config.Resource]]; ok {
+			info.processPID = processPID
+			info.processSoft, info.processHard = values[0], values[1]
+		}
+		results = append(results, info)
 	}
 
 	return results, nil
 }
 
-// GetMattermostProcessEnv gets Mattermost process environment variables
-func GetMattermostProcessEnv() ([]string, error) {
+// readProcessLimits parses /proc/<pid>/limits into soft and hard values keyed by the
+// row label, e.g. "Max open files". Unlimited values map to RLIM_INFINITY.
+func readProcessLimits(pid int) (map[string][2]uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limits for PID %d: %w", pid, err)
+	}
+
+	limits, err := parseProcessLimits(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse /proc/%d/limits: %w", pid, err)
+	}
+	return limits, nil
+}
+
+// parseProcessLimits parses the content of a /proc/<pid>/limits file. The labels and
+// units contain spaces, so the columns are cut at the offsets of the header.
+func parseProcessLimits(data string) (map[string][2]uint64, error) {
+	lines := strings.Split(data, "\n")
+	softStart := strings.Index(lines[0], "Soft Limit")
+	hardStart := strings.Index(lines[0], "Hard Limit")
+	unitsStart := strings.Index(lines[0], "Units")
+	if softStart < 0 || hardStart < softStart || unitsStart < hardStart {
+		return nil, fmt.Errorf("unexpected header %q", lines[0])
+	}
+
+	parse := func(value string) (uint64, error) {
+		value = strings.TrimSpace(value)
+		if value == "unlimited" {
+			return unix.RLIM_INFINITY, nil
+		}
+		return strconv.ParseUint(value, 10, 64)
+	}
+
+	limits := make(map[string][2]uint64)
+	for _, line := range lines[1:] {
+		if len(line) <= hardStart {
+			continue
+		}
+		soft, err := parse(line[softStart:hardStart])
+		if err != nil {
+			continue
+		}
+		hard, err := parse(line[hardStart:min(len(line), unitsStart)])
+		if err != nil {
+			continue
+		}
+		limits[strings.TrimSpace(line[:softStart])] = [2]uint64{soft, hard}
+	}
+
+	return limits, nil
+}
+
+// GetMattermostProcessEnv gets Mattermost process environment variables (MM_, proxy and Go runtime settings).
+// The list is empty when the process sets none of them.
+func GetMattermostProcessEnv(selector *processSelector) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	proc, err := findMattermostProcess(ctx)
+	proc, err := findMattermostProcess(ctx, selector)
 	if err != nil {
 		return nil, err
 	}
@@ -251,59 +339,52 @@ func GetMattermostProcessEnv() ([]string, error) {
 
 	var filtered []string
 	for _, env := range environ {
-		if strings.HasPrefix(env, "MM_") {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "MM_") || isProxyEnv(name) || isGoRuntimeEnv(name) {
 			filtered = append(filtered, env)
 		}
 	}
 
-	if len(filtered) == 0 {
-		return nil, fmt.Errorf("no MM_ environment variables found")
-	}
-
 	sort.Strings(filtered)
 	return filtered, nil
 }
 
-// findMattermostProcess finds the mattermost process
-func findMattermostProcess(ctx context.Context) (*procfs.Proc, error) {
+// GetMattermostProcessEnviron returns the complete environment of the Mattermost process.
+func GetMattermostProcessEnviron(selector *processSelector) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	environ, err := proc.Environ()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment for PID %d: %w", proc.PID, err)
+	}
+
+	env := make(map[string]string, len(environ))
+	for _, e := range environ {
+		name, value, _ := strings.Cut(e, "=")
+		env[name] = value
+	}
+	return env, nil
+}
+
+// findMattermostProcess finds the mattermost process chosen by selector. It fails
+// with a *multipleProcessesError listing the candidates when several processes match.
+func findMattermostProcess(ctx context.Context, selector *processSelector) (*procfs.Proc, error) {
 	done := make(chan struct {
 		proc *procfs.Proc
 		err  error
 	}, 1)
 
 	go func() {
-		fs, err := procfs.NewFS("/proc")
-		if err != nil {
-			done <- struct {
-				proc *procfs.Proc
-				err  error
-			}{nil, fmt.Errorf("procfs access failed: %w", err)}
-			return
-		}
-
-		procs, err := fs.AllProcs()
-		if err != nil {
-			done <- struct {
-				proc *procfs.Proc
-				err  error
-			}{nil, fmt.Errorf("failed to get process list: %w", err)}
-			return
-		}
-
-		for _, proc := range procs {
-			if comm, err := proc.Comm(); err == nil && comm == "mattermost" {
-				done <- struct {
-					proc *procfs.Proc
-					err  error
-				}{&proc, nil}
-				return
-			}
-		}
-
+		proc, err := selectProcess(selector)
 		done <- struct {
 			proc *procfs.Proc
 			err  error
-		}{nil, fmt.Errorf("mattermost process not found")}
+		}{proc, err}
 	}()
 
 	select {
@@ -314,7 +395,114 @@ func findMattermostProcess(ctx context.Context) (*procfs.Proc, error) {
 	}
 }
 
+// selectProcess scans /proc for the processes matching selector.
+func selectProcess(selector *processSelector) (*procfs.Proc, error) {
+	fs, err := procfs.NewFS("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("procfs access failed: %w", err)
+	}
+
+	if selector.pid != 0 {
+		proc, err := fs.Proc(selector.pid)
+		if err != nil {
+			return nil, fmt.Errorf("process with PID %d not found: %w", selector.pid, err)
+		}
+		return &proc, nil
+	}
 
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process list: %w", err)
+	}
+
+	self := os.Getpid()
+	var found []procfs.Proc
+	for _, proc := range procs {
+		if proc.PID == self {
+			continue
+		}
+		comm, err := proc.Comm()
+		if err != nil {
+			continue
+		}
+
+		var cmdline, exe string
+		var cgroupPaths []string
+		if selector.explicit() {
+			if args, err := proc.CmdLine(); err == nil {
+				cmdline = strings.Join(args, " ")
+			}
+			exe, _ = proc.Executable()
+			if cgroups, err := proc.Cgroups(); err == nil {
+				for _, cgroup := range cgroups {
+					cgroupPaths = append(cgroupPaths, cgroup.Path)
+				}
+			}
+		}
+
+		if selector.matches(comm, cmdline, exe, cgroupPaths) {
+			found = append(found, proc)
+		}
+	}
+	found = topmostProcesses(found)
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("mattermost process not found (selected by %s)", selector)
+	case 1:
+		return &found[0], nil
+	}
+
+	matches := make([]processMatch, 0, len(found))
+	for _, proc := range found {
+		match := processMatch{pid: proc.PID}
+		if stat, err := proc.Stat(); err == nil {
+			if started, err := stat.StartTime(); err == nil {
+				match.started = time.Unix(int64(started), 0)
+			}
+		}
+		if status, err := proc.NewStatus(); err == nil {
+			match.user = lookupUsername(status.UIDs[0])
+		}
+		if args, err := proc.CmdLine(); err == nil {
+			match.cmdline = strings.Join(args, " ")
+		}
+		matches = append(matches, match)
+	}
+	return nil, &multipleProcessesError{selector: selector, matches: matches}
+}
+
+// topmostProcesses drops the processes whose parent is among procs, such as plugins
+// started by a server whose executable path also matches -process-name.
+func topmostProcesses(procs []procfs.Proc) []procfs.Proc {
+	if len(procs) < 2 {
+		return procs
+	}
+
+	pids := make(map[int]bool, len(procs))
+	for _, proc := range procs {
+		pids[proc.PID] = true
+	}
+	var topmost []procfs.Proc
+	for _, proc := range procs {
+		if stat, err := proc.Stat(); err == nil && pids[stat.PPID] {
+			continue
+		}
+		topmost = append(topmost, proc)
+	}
+	return topmost
+}
+
+// lookupUsername returns the name of uid, or the numeric UID if it has no passwd entry.
+func lookupUsername(uid uint64) string {
+	id := strconv.FormatUint(uid, 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// formatUlimitValue formats a resource limit, showing RLIM_INFINITY as "unlimited".
 func formatUlimitValue(value uint64) string {
 	if value == unix.RLIM_INFINITY {
 		return "unlimited"
@@ -323,22 +511,28 @@ func formatUlimitValue(value uint64) string {
 }
 
 // Print functions
-func PrintSysctls() error {
+
+// PrintSysctls prints the kernel parameters next to their expected values. It returns
+// false if any of them does not match.
+func PrintSysctls() (bool, error) {
 	sysctls, err := GetSysctls()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.AppendHeader(table.Row{"Parameter", "Expected", "Actual", "Status"})
 
+	allOK := true
 	for _, sysctl := range sysctls {
 		status := text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
 		actual := text.Colors{text.Bold, text.FgRed}.Sprint(sysctl.actual)
 		if sysctl.matches {
 			status = text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
 			actual = text.Colors{text.Bold, text.FgGreen}.Sprint(sysctl.actual)
+		} else {
+			allOK = false
 		}
 		t.AppendRow(table.Row{
 			sysctl.name,
@@ -352,69 +546,102 @@ func PrintSysctls() error {
 	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprint("Sysctl Parameters:"))
 	t.Render()
 
-	return nil
+	return allOK, nil
 }
 
-func PrintUlimits() error {
-	ulimits, err := GetUlimits()
+// PrintUlimits prints the resource limits of this shell and of the Mattermost process.
+// It returns false if any limit that decides the status is below the expected value.
+func PrintUlimits(selector *processSelector, threadWarn float64) (bool, error) {
+	ulimits, err := GetUlimits(selector)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	processPID := 0
+	for _, limit := range ulimits {
+		if limit.processPID != 0 {
+			processPID = limit.processPID
+		}
 	}
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Resource", "Type", "Expected", "Actual", "Status"})
+	header := table.Row{"Resource", "Type", "Expected", "Shell"}
+	if processPID != 0 {
+		header = append(header, fmt.Sprintf("Mattermost (PID %d)", processPID))
+	}
+	t.AppendHeader(append(header, "Status"))
 
+	allOK := true
 	for _, limit := range ulimits {
-		// Soft limit row
-		softActual := formatUlimitValue(limit.softLimit)
-		softMatches := limit.softLimit >= limit.expectedSoft || limit.softLimit == unix.RLIM_INFINITY
-		softStatus := text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
-		softActualColored := text.Colors{text.Bold, text.FgRed}.Sprint(softActual)
-		if softMatches {
-			softStatus = text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
-			softActualColored = text.Colors{text.Bold, text.FgGreen}.Sprint(softActual)
+		rows := []struct {
+			typ      string
+			expected uint64
+			shell    uint64
+			process  uint64
+		}{
+			{"soft", limit.expectedSoft, limit.softLimit, limit.processSoft},
+			{"hard", limit.expectedHard, limit.hardLimit, limit.processHard},
 		}
 
-		t.AppendRow(table.Row{
-			limit.resourceName,
-			"soft",
-			limit.expectedSoft,
-			softActualColored,
-			softStatus,
-		})
+		for _, r := range rows {
+			// The server's own limit decides the status when it is known.
+			effective := r.shell
+			if limit.processPID != 0 {
+				effective = r.process
+			}
+			matches := effective >= r.expected || effective == unix.RLIM_INFINITY
+			color := text.Colors{text.Bold, text.FgRed}
+			status := color.Sprint("FAIL")
+			if matches {
+				color = text.Colors{text.Bold, text.FgGreen}
+				status = color.Sprint("OK")
+			} else {
+				allOK = false
+			}
 
-		// Hard limit row
-		hardActual := formatUlimitValue(limit.hardLimit)
-		hardMatches := limit.hardLimit >= limit.expectedHard || limit.hardLimit == unix.RLIM_INFINITY
-		hardStatus := text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
-		hardActualColored := text.Colors{text.Bold, text.FgRed}.Sprint(hardActual)
-		if hardMatches {
-			hardStatus = text.Colors{text.Bold, text.FgGreen}.Sprint("OK")
-			hardActualColored = text.Colors{text.Bold, text.FgGreen}.Sprint(hardActual)
+			row := table.Row{limit.resourceName, r.typ, r.expected}
+			switch {
+			case processPID == 0:
+				row = append(row, color.Sprint(formatUlimitValue(r.shell)))
+			case limit.processPID == 0:
+				row = append(row, formatUlimitValue(r.shell), text.Colors{text.Faint}.Sprint("n/a"))
+			default:
+				row = append(row, formatUlimitValue(r.shell), color.Sprint(formatUlimitValue(r.process)))
+			}
+			t.AppendRow(append(row, status))
 		}
-
-		t.AppendRow(table.Row{
-			limit.resourceName,
-			"hard",
-			limit.expectedHard,
-			hardActualColored,
-			hardStatus,
-		})
 	}
 
 	t.SetStyle(table.StyleDefault)
 	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprint("Resource Limits:"))
 	t.Render()
 
-	return nil
+	if processPID == 0 {
+		fmt.Printf("%s\n", text.Colors{text.FgYellow}.Sprint("Mattermost process not found; showing the limits of this shell only"))
+		return allOK, nil
+	}
+
+	// nproc is checked against all threads of the user, not the processes of Mattermost.
+	threadsOK, err := PrintMattermostUserThreads(selector, threadWarn)
+	if err != nil {
+		fmt.Printf("Failed to count threads of the Mattermost user: %v\n", err)
+	}
+
+	return allOK && (threadsOK || err != nil), nil
 }
 
-func PrintMattermostProcessEnv() error {
-	envVars, err := GetMattermostProcessEnv()
+func PrintMattermostProcessEnv(selector *processSelector) error {
+	envVars, err := GetMattermostProcessEnv(selector)
 	if err != nil {
 		return err
 	}
+	// Configuration may come from config.json or the database alone; the Go runtime
+	// comparison that follows still applies.
+	if len(envVars) == 0 {
+		fmt.Printf("%s\n", text.Colors{text.FgYellow}.Sprint("No MM_, proxy or Go runtime environment variables set in the Mattermost process"))
+		return nil
+	}
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
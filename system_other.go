@@ -4,7 +4,6 @@ package main
 
 import (
 	"fmt"
-	"runtime"
 )
 
 // Core data structures
@@ -34,30 +33,42 @@ type ulimitInfo struct {
 	hardLimit    uint64
 	expectedSoft uint64
 	expectedHard uint64
+	processPID   int
+	processSoft  uint64
+	processHard  uint64
 }
 
 // Stub implementations for non-Linux systems
 func GetSysctls() ([]sysctlInfo, error) {
-	return nil, fmt.Errorf("sysctl reading is only supported on Linux, current OS: %s", runtime.GOOS)
+	return nil, fmt.Errorf("sysctl reading is %w", errUnsupportedPlatform)
 }
 
-func GetUlimits() ([]ulimitInfo, error) {
-	return nil, fmt.Errorf("ulimits are only supported on Linux, current OS: %s", runtime.GOOS)
+func GetUlimits(selector *processSelector) ([]ulimitInfo, error) {
+	return nil, fmt.Errorf("ulimits are %w", errUnsupportedPlatform)
 }
 
-func GetMattermostProcessEnv() ([]string, error) {
-	return nil, fmt.Errorf("reading Mattermost process environment variables is only supported on Linux, current OS: %s", runtime.GOOS)
+func GetMattermostProcessEnv(selector *processSelector) ([]string, error) {
+	return nil, fmt.Errorf("reading Mattermost process environment variables is %w", errUnsupportedPlatform)
 }
 
-func PrintSysctls() error {
-	return fmt.Errorf("sysctl reading is only supported on Linux, current OS: %s", runtime.GOOS)
+func GetMattermostProcessEnviron(selector *processSelector) (map[string]string, error) {
+	return nil, fmt.Errorf("reading Mattermost process environment variables is %w", errUnsupportedPlatform)
 }
 
-func PrintUlimits() error {
-	return fmt.Errorf("ulimits are only supported on Linux, current OS: %s", runtime.GOOS)
+func PrintSysctls() (bool, error) {
+	return false, fmt.Errorf("sysctl reading is %w", errUnsupportedPlatform)
 }
 
-func PrintMattermostProcessEnv() error {
-	return fmt.Errorf("reading Mattermost process environment variables is only supported on Linux, current OS: %s", runtime.GOOS)
+func PrintUlimits(selector *processSelector, threadWarn float64) (bool, error) {
+	return false, fmt.Errorf("ulimits are %w", errUnsupportedPlatform)
 }
 
+func PrintMattermostProcessEnv(selector *processSelector) error {
+	return fmt.Errorf("reading Mattermost process environment variables is %w", errUnsupportedPlatform)
+}
+
+// formatUlimitValue formats a resource limit. Limits are only read on Linux, so there
+// is no RLIM_INFINITY to show as "unlimited".
+func formatUlimitValue(value uint64) string {
+	return fmt.Sprintf("%d", value)
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// processLimitsSample is /proc/<pid>/limits of a Mattermost server run by systemd with
+// LimitNOFILE=49152, including the kernel's trailing padding.
+var processLimitsSample = strings.Join([]string{
+	"Limit                     Soft Limit           Hard Limit           Units     ",
+	"Max cpu time              unlimited            unlimited            seconds   ",
+	"Max file size             unlimited            unlimited            bytes     ",
+	"Max stack size            8388608              unlimited            bytes     ",
+	"Max core file size        0                    unlimited            bytes     ",
+	"Max processes             63413                63413                processes ",
+	"Max open files            49152                49152                files     ",
+	"Max locked memory         8388608              8388608              bytes     ",
+	"Max pending signals       63413                63413                signals   ",
+	"Max nice priority         0                    0                    ",
+	"Max realtime priority     0                    0                    ",
+	"Max realtime timeout      unlimited            unlimited            us        ",
+	"",
+}, "\n")
+
+func TestParseProcessLimits(t *testing.T) {
+	limits, err := parseProcessLimits(processLimitsSample)
+	if err != nil {
+		t.Fatalf("parseProcessLimits: %v", err)
+	}
+
+	want := map[string][2]uint64{
+		"Max cpu time":          {unix.RLIM_INFINITY, unix.RLIM_INFINITY},
+		"Max file size":         {unix.RLIM_INFINITY, unix.RLIM_INFINITY},
+		"Max stack size":        {8388608, unix.RLIM_INFINITY},
+		"Max core file size":    {0, unix.RLIM_INFINITY},
+		"Max processes":         {63413, 63413},
+		"Max open files":        {49152, 49152},
+		"Max locked memory":     {8388608, 8388608},
+		"Max pending signals":   {63413, 63413},
+		"Max nice priority":     {0, 0},
+		"Max realtime priority": {0, 0},
+		"Max realtime timeout":  {unix.RLIM_INFINITY, unix.RLIM_INFINITY},
+	}
+	if !reflect.DeepEqual(limits, want) {
+		t.Errorf("parseProcessLimits = %v, want %v", limits, want)
+	}
+
+	// Every resource GetUlimits checks must be found under its label.
+	for resource, label := range ulimitProcNames {
+		if _, ok := limits[label]; !ok {
+			t.Errorf("label %q of resource %d not parsed", label, resource)
+		}
+	}
+}
+
+func TestParseProcessLimitsMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		want    map[string][2]uint64
+	}{
+		{name: "empty", data: "", wantErr: true},
+		{name: "unknown header", data: "Resource Soft Hard\nMax open files 1024 4096\n", wantErr: true},
+		{
+			name: "unparsable rows are skipped",
+			data: "Limit                     Soft Limit           Hard Limit           Units     \n" +
+				"Max open files            lots                 4096                 files     \n" +
+				"Max processes             4096                 4096                 processes \n" +
+				"Max\n",
+			want: map[string][2]uint64{"Max processes": {4096, 4096}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits, err := parseProcessLimits(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseProcessLimits = %v, want error", limits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProcessLimits: %v", err)
+			}
+			if !reflect.DeepEqual(limits, tt.want) {
+				t.Errorf("parseProcessLimits = %v, want %v", limits, tt.want)
+			}
+		})
+	}
+}
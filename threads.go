@@ -0,0 +1,161 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+// threadTopProcesses is how many processes of the user are listed.
+const threadTopProcesses = 10
+
+// processThreads is the thread count of a single process.
+type processThreads struct {
+	pid     int
+	comm    string
+	role    string
+	threads int
+}
+
+// userThreadInfo is the number of threads running as the Mattermost service user,
+// which is what RLIMIT_NPROC is checked against when a thread or process is created.
+type userThreadInfo struct {
+	pid       int
+	uid       uint64
+	user      string
+	total     int
+	processes []processThreads
+	softLimit uint64
+	hardLimit uint64
+}
+
+// usage returns the threads as a percentage of the soft nproc limit. The limit is not
+// enforced for root, so its usage is 0.
+func (i *userThreadInfo) usage() float64 {
+	if i.uid == 0 || i.softLimit == 0 || i.softLimit == unix.RLIM_INFINITY {
+		return 0
+	}
+	return float64(i.total) * 100 / float64(i.softLimit)
+}
+
+// GetMattermostUserThreads counts the threads in /proc/*/task of every process whose
+// real UID is the Mattermost process's, including plugin subprocesses, and reads the
+// nproc limit the server runs with.
+func GetMattermostUserThreads(selector *processSelector) (*userThreadInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	mm, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := mm.NewStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status of PID %d: %w", mm.PID, err)
+	}
+
+	info := &userThreadInfo{pid: mm.PID, uid: status.UIDs[0], user: lookupUsername(status.UIDs[0])}
+
+	fs, err := procfs.NewFS("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("procfs access failed: %w", err)
+	}
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process list: %w", err)
+	}
+
+	for _, proc := range procs {
+		procStatus, err := proc.NewStatus()
+		if err != nil || procStatus.UIDs[0] != info.uid {
+			continue
+		}
+		tasks, err := os.ReadDir("/proc/" + strconv.Itoa(proc.PID) + "/task")
+		if err != nil {
+			continue
+		}
+
+		entry := processThreads{pid: proc.PID, threads: len(tasks)}
+		if stat, err := proc.Stat(); err == nil {
+			entry.comm = stat.Comm
+			switch {
+			case proc.PID == mm.PID:
+				entry.role = "Mattermost"
+			case stat.PPID == mm.PID:
+				entry.role = "plugin"
+			}
+		}
+		info.total += entry.threads
+		info.processes = append(info.processes, entry)
+	}
+
+	// Mattermost and its plugins come first, then the other processes of the user.
+	sort.Slice(info.processes, func(i, j int) bool {
+		a, b := info.processes[i], info.processes[j]
+		if (a.role != "") != (b.role != "") {
+			return a.role != ""
+		}
+		if a.role != b.role {
+			return a.role == "Mattermost"
+		}
+		return a.threads > b.threads
+	})
+
+	limits, err := readProcessLimits(mm.PID)
+	if err != nil {
+		return nil, err
+	}
+	if values, ok := limits[ulimitProcNames[unix.RLIMIT_NPROC]]; ok {
+		info.softLimit, info.hardLimit = values[0], values[1]
+	}
+
+	return info, nil
+}
+
+// PrintMattermostUserThreads prints the threads of the Mattermost service user against
+// the nproc limit, with the processes holding the most threads. It reports false when
+// the threads reach warnPercent of the limit.
+func PrintMattermostUserThreads(selector *processSelector, warnPercent float64) (bool, error) {
+	info, err := GetMattermostUserThreads(selector)
+	if err != nil {
+		return false, err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"PID", "Command", "Role", "Threads"})
+	for i, proc := range info.processes {
+		if i == threadTopProcesses {
+			t.AppendRow(table.Row{"", fmt.Sprintf("(%d more processes)", len(info.processes)-i), "", ""})
+			break
+		}
+		t.AppendRow(table.Row{proc.pid, proc.comm, proc.role, proc.threads})
+	}
+	t.AppendFooter(table.Row{"", "", "Total", info.total})
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Threads of User %s (UID %d):", info.user, info.uid))
+	t.Render()
+
+	ok := info.usage() < warnPercent
+	color := text.Colors{text.Bold, text.FgGreen}
+	if !ok {
+		color = text.Colors{text.Bold, text.FgRed}
+	}
+	fmt.Printf("%s\n", color.Sprintf("Threads: %d of nproc %s (%.1f%%)", info.total, formatUlimitValue(info.softLimit), info.usage()))
+	if info.uid == 0 {
+		fmt.Printf("  Note: the nproc limit is not enforced for root\n")
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// userThreadInfo is the number of threads running as the Mattermost service user.
+type userThreadInfo struct {
+	pid       int
+	uid       uint64
+	total     int
+	softLimit uint64
+}
+
+// usage returns the threads as a percentage of the soft nproc limit.
+func (i *userThreadInfo) usage() float64 {
+	if i.uid == 0 || i.softLimit == 0 {
+		return 0
+	}
+	return float64(i.total) * 100 / float64(i.softLimit)
+}
+
+// GetMattermostUserThreads is not available outside Linux, where /proc is used.
+func GetMattermostUserThreads(selector *processSelector) (*userThreadInfo, error) {
+	return nil, fmt.Errorf("counting threads is %w", errUnsupportedPlatform)
+}
@@ -2,41 +2,44 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"time"
 )
 
 // tlsTestResult contains information about a TLS handshake test.
 type tlsTestResult struct {
-	success          bool
-	version          uint16
-	cipherSuite      uint16
-	serverName       string
-	peerCertificates int
-	err              error
+	success            bool
+	version            uint16
+	cipherSuite        uint16
+	serverName         string
+	negotiatedProtocol string
+	peerCertificates   int
+	err                error
 }
 
 // testTLSHandshake performs a TLS handshake similar to openssl s_client.
-func testTLSHandshake(host string, port int, timeout time.Duration) *tlsTestResult {
+func testTLSHandshake(host string, port int, alpn []string, dialer *probeDialer) *tlsTestResult {
 	result := &tlsTestResult{
 		serverName: host,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Create TLS configuration
 	config := &tls.Config{
 		ServerName: host,
+		NextProtos: alpn,
 	}
 
 	// Establish connection with timeout
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
-	conn, err := tls.DialWithDialer(dialer, "tcp", address, config)
+	conn, err := dialer.DialTLS("tcp", address, config)
 	if err != nil {
 		result.err = fmt.Errorf("TLS handshake failed: %w", err)
 		return result
@@ -49,31 +52,29 @@ func testTLSHandshake(host string, port int, timeout time.Duration) *tlsTestResu
 	result.success = true
 	result.version = state.Version
 	result.cipherSuite = state.CipherSuite
+	result.negotiatedProtocol = state.NegotiatedProtocol
 	result.peerCertificates = len(state.PeerCertificates)
 
 	return result
 }
 
 // testTLSHandshakeInsecure performs a TLS handshake without certificate verification.
-func testTLSHandshakeInsecure(host string, port int, timeout time.Duration) *tlsTestResult {
+func testTLSHandshakeInsecure(host string, port int, alpn []string, dialer *probeDialer) *tlsTestResult {
 	result := &tlsTestResult{
 		serverName: host,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Create TLS configuration with insecure verification
 	config := &tls.Config{
 		ServerName:         host,
 		InsecureSkipVerify: true,
+		NextProtos:         alpn,
 	}
 
 	// Establish connection with timeout
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
-	conn, err := tls.DialWithDialer(dialer, "tcp", address, config)
+	conn, err := dialer.DialTLS("tcp", address, config)
 	if err != nil {
 		result.err = fmt.Errorf("TLS handshake failed: %w", err)
 		return result
@@ -86,30 +87,28 @@ func testTLSHandshakeInsecure(host string, port int, timeout time.Duration) *tls
 	result.success = true
 	result.version = state.Version
 	result.cipherSuite = state.CipherSuite
+	result.negotiatedProtocol = state.NegotiatedProtocol
 	result.peerCertificates = len(state.PeerCertificates)
 
 	return result
 }
 
 // testTLSHandshakeWithSNI performs a TLS handshake with custom SNI.
-func testTLSHandshakeWithSNI(host string, port int, sni string, timeout time.Duration) *tlsTestResult {
+func testTLSHandshakeWithSNI(host string, port int, sni string, alpn []string, dialer *probeDialer) *tlsTestResult {
 	result := &tlsTestResult{
 		serverName: sni,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Create TLS configuration with custom SNI
 	config := &tls.Config{
 		ServerName: sni,
+		NextProtos: alpn,
 	}
 
 	// Establish connection with timeout
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
-	conn, err := tls.DialWithDialer(dialer, "tcp", address, config)
+	conn, err := dialer.DialTLS("tcp", address, config)
 	if err != nil {
 		result.err = fmt.Errorf("TLS handshake failed: %w", err)
 		return result
@@ -122,24 +121,21 @@ func testTLSHandshakeWithSNI(host string, port int, sni string, timeout time.Dur
 	result.success = true
 	result.version = state.Version
 	result.cipherSuite = state.CipherSuite
+	result.negotiatedProtocol = state.NegotiatedProtocol
 	result.peerCertificates = len(state.PeerCertificates)
 
 	return result
 }
 
 // testPostgresSTARTTLS performs a STARTTLS handshake with a PostgreSQL server.
-func testPostgresSTARTTLS(host string, port int, timeout time.Duration) *tlsTestResult {
+func testPostgresSTARTTLS(host string, port int, alpn []string, dialer *probeDialer) *tlsTestResult {
 	result := &tlsTestResult{
 		serverName: host,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Establish plain TCP connection
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
 	conn, err := dialer.Dial("tcp", address)
 	if err != nil {
 		result.err = fmt.Errorf("failed to connect to postgres: %w", err)
@@ -147,6 +143,10 @@ func testPostgresSTARTTLS(host string, port int, timeout time.Duration) *tlsTest
 	}
 	defer conn.Close()
 
+	// The dialer timeout only covers connecting; a server that accepts the connection
+	// and never answers would otherwise block batch workers and -watch forever.
+	_ = conn.SetDeadline(time.Now().Add(dialer.timeout))
+
 	// Send PostgreSQL STARTTLS request (SSLRequest message)
 	// Message format: length (4 bytes) + SSL request code (4 bytes)
 	sslRequest := []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
@@ -166,17 +166,20 @@ func testPostgresSTARTTLS(host string, port int, timeout time.Duration) *tlsTest
 	}
 
 	if response[0] != 'S' {
-		result.err = fmt.Errorf("server does not support SSL (response: %c)", response[0])
+		result.err = fmt.Errorf("%w: server does not support SSL (response: %c)", errSTARTTLSRefused, response[0])
 		return result
 	}
 
 	// Upgrade to TLS
 	tlsConfig := &tls.Config{
 		ServerName: host,
+		NextProtos: alpn,
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), dialer.timeout)
+	defer cancel()
 	tlsConn := tls.Client(conn, tlsConfig)
-	err = tlsConn.Handshake()
+	err = tlsConn.HandshakeContext(ctx)
 	if err != nil {
 		result.err = fmt.Errorf("TLS handshake failed: %w", err)
 		return result
@@ -188,24 +191,21 @@ func testPostgresSTARTTLS(host string, port int, timeout time.Duration) *tlsTest
 	result.success = true
 	result.version = state.Version
 	result.cipherSuite = state.CipherSuite
+	result.negotiatedProtocol = state.NegotiatedProtocol
 	result.peerCertificates = len(state.PeerCertificates)
 
 	return result
 }
 
 // testLDAPSTARTTLS performs a STARTTLS handshake with an LDAP server.
-func testLDAPSTARTTLS(host string, port int, timeout time.Duration) *tlsTestResult {
+func testLDAPSTARTTLS(host string, port int, alpn []string, dialer *probeDialer) *tlsTestResult {
 	result := &tlsTestResult{
 		serverName: host,
 	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 
 	// Establish plain TCP connection
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
 	conn, err := dialer.Dial("tcp", address)
 	if err != nil {
 		result.err = fmt.Errorf("failed to connect to LDAP: %w", err)
@@ -213,6 +213,10 @@ func testLDAPSTARTTLS(host string, port int, timeout time.Duration) *tlsTestResu
 	}
 	defer conn.Close()
 
+	// The dialer timeout only covers connecting; a server that accepts the connection
+	// and never answers would otherwise block batch workers and -watch forever.
+	_ = conn.SetDeadline(time.Now().Add(dialer.timeout))
+
 	// Send LDAP STARTTLS Extended Operation request
 	// This is a simplified LDAP STARTTLS request (BER encoded)
 	startTLSRequest := []byte{
@@ -231,28 +235,36 @@ func testLDAPSTARTTLS(host string, port int, timeout time.Duration) *tlsTestResu
 		return result
 	}
 
-	// Read response
-	reader := bufio.NewReader(conn)
-	response := make([]byte, 1024)
-	n, err := reader.Read(response)
+	// Read the ExtendedResponse; a server that declines answers it with a non-zero
+	// resultCode, such as protocolError or unavailable.
+	response, err := readLDAPMessage(bufio.NewReader(conn))
 	if err != nil {
 		result.err = fmt.Errorf("failed to read STARTTLS response: %w", err)
 		return result
 	}
-
-	// Check if response indicates success (simplified check)
-	if n < 10 {
-		result.err = fmt.Errorf("invalid STARTTLS response length: %d", n)
+	code, diagnostic, err := parseLDAPExtendedResponse(response)
+	if err != nil {
+		result.err = fmt.Errorf("%w: invalid STARTTLS response: %v", errSTARTTLSRefused, err)
+		return result
+	}
+	if code != 0 {
+		result.err = fmt.Errorf("%w: LDAP resultCode %d", errSTARTTLSRefused, code)
+		if diagnostic != "" {
+			result.err = fmt.Errorf("%w (%s)", result.err, diagnostic)
+		}
 		return result
 	}
 
 	// Upgrade to TLS
 	tlsConfig := &tls.Config{
 		ServerName: host,
+		NextProtos: alpn,
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), dialer.timeout)
+	defer cancel()
 	tlsConn := tls.Client(conn, tlsConfig)
-	err = tlsConn.Handshake()
+	err = tlsConn.HandshakeContext(ctx)
 	if err != nil {
 		result.err = fmt.Errorf("TLS handshake failed: %w", err)
 		return result
@@ -264,7 +276,105 @@ func testLDAPSTARTTLS(host string, port int, timeout time.Duration) *tlsTestResu
 	result.success = true
 	result.version = state.Version
 	result.cipherSuite = state.CipherSuite
+	result.negotiatedProtocol = state.NegotiatedProtocol
 	result.peerCertificates = len(state.PeerCertificates)
 
 	return result
 }
+
+// readBERLength reads a BER definite length.
+func readBERLength(r io.ByteReader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int(b), nil
+	}
+	n := int(b & 0x7f)
+	if n == 0 || n > 3 {
+		return 0, fmt.Errorf("unsupported BER length encoding 0x%02x", b)
+	}
+	length := 0
+	for i := 0; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+// readBERElement reads the tag and contents of the next BER element in r.
+func readBERElement(r *bytes.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readBERLength(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > r.Len() {
+		return 0, nil, fmt.Errorf("element 0x%02x of %d bytes is truncated", tag, length)
+	}
+	contents := make([]byte, length)
+	r.Read(contents)
+	return tag, contents, nil
+}
+
+// readLDAPMessage reads one LDAPMessage and returns the contents of its SEQUENCE.
+func readLDAPMessage(r *bufio.Reader) ([]byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x30 {
+		return nil, fmt.Errorf("not an LDAP message (tag 0x%02x)", tag)
+	}
+	length, err := readBERLength(r)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// parseLDAPExtendedResponse returns the resultCode and diagnosticMessage of the
+// ExtendedResponse in the contents of an LDAPMessage (RFC 4511 section 4.12).
+func parseLDAPExtendedResponse(message []byte) (int, string, error) {
+	r := bytes.NewReader(message)
+	if tag, _, err := readBERElement(r); err != nil || tag != 0x02 {
+		return 0, "", errors.New("missing messageID")
+	}
+	tag, op, err := readBERElement(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x78 {
+		return 0, "", fmt.Errorf("unexpected protocolOp 0x%02x, want ExtendedResponse", tag)
+	}
+
+	r = bytes.NewReader(op)
+	tag, code, err := readBERElement(r)
+	if err != nil || tag != 0x0a || len(code) == 0 || len(code) > 4 {
+		return 0, "", errors.New("missing resultCode")
+	}
+	resultCode := 0
+	for _, b := range code {
+		resultCode = resultCode<<8 | int(b)
+	}
+
+	// matchedDN and diagnosticMessage follow; the message is only informational.
+	var diagnostic string
+	if tag, _, err := readBERElement(r); err == nil && tag == 0x04 {
+		if tag, msg, err := readBERElement(r); err == nil && tag == 0x04 {
+			diagnostic = string(msg)
+		}
+	}
+	return resultCode, diagnostic, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseLDAPExtendedResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		code       int
+		diagnostic string
+		wantErr    bool
+	}{
+		{
+			// OpenLDAP accepting STARTTLS, with the responseName echoed back.
+			name:    "success",
+			message: "02 01 01 78 1f 0a 01 00 04 00 04 00 8a 16 " + hex.EncodeToString([]byte("1.3.6.1.4.1.1466.20037")),
+			code:    0,
+		},
+		{
+			name:       "protocolError with diagnostic",
+			message:    "02 01 01 78 25 0a 01 02 04 00 04 1e " + hex.EncodeToString([]byte("unsupported extended operation")),
+			code:       2,
+			diagnostic: "unsupported extended operation",
+		},
+		{
+			name:    "unavailable",
+			message: "02 01 01 78 07 0a 01 34 04 00 04 00",
+			code:    52,
+		},
+		{
+			name:    "not an ExtendedResponse",
+			message: "02 01 01 65 07 0a 01 00 04 00 04 00",
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			message: "02 01 01 78 07 0a 01",
+			wantErr: true,
+		},
+		{
+			name:    "missing resultCode",
+			message: "02 01 01 78 02 04 00",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			message: "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, diagnostic, err := parseLDAPExtendedResponse(mustHex(t, tt.message))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLDAPExtendedResponse = %d %q, want error", code, diagnostic)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLDAPExtendedResponse: %v", err)
+			}
+			if code != tt.code || diagnostic != tt.diagnostic {
+				t.Errorf("parseLDAPExtendedResponse = %d %q, want %d %q", code, diagnostic, tt.code, tt.diagnostic)
+			}
+		})
+	}
+}
+
+func TestReadLDAPMessage(t *testing.T) {
+	body := "02 01 01 78 07 0a 01 34 04 00 04 00"
+	tests := []struct {
+		name    string
+		frame   string
+		wantErr bool
+	}{
+		{name: "short length", frame: "30 0c " + body},
+		{name: "long length", frame: "30 81 0c " + body},
+		{name: "trailing data is left unread", frame: "30 0c " + body + " 30 00"},
+		{name: "not a sequence", frame: "31 0c " + body, wantErr: true},
+		{name: "truncated", frame: "30 0d " + body, wantErr: true},
+		{name: "indefinite length", frame: "30 80 " + body, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readLDAPMessage(bufio.NewReader(bytes.NewReader(mustHex(t, tt.frame))))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readLDAPMessage = % x, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLDAPMessage: %v", err)
+			}
+			if want := mustHex(t, body); !bytes.Equal(got, want) {
+				t.Errorf("readLDAPMessage = % x, want % x", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// TURN message types and attributes (RFC 5766).
+const (
+	turnAllocateRequest = 0x0003
+	turnAllocateSuccess = 0x0103
+	turnAllocateError   = 0x0113
+	turnRefreshRequest  = 0x0004
+
+	turnAttrLifetime           = 0x000D
+	turnAttrXORRelayedAddress  = 0x0016
+	turnAttrRequestedTransport = 0x0019
+
+	turnTransportUDP = 17
+
+	turnErrUnauthorized = 401
+	turnErrStaleNonce   = 438
+
+	// turnSecretCredentialTTL is the validity of credentials derived from a static auth secret.
+	turnSecretCredentialTTL = time.Hour
+)
+
+// turnTestResult contains information about a TURN allocation test.
+type turnTestResult struct {
+	success     bool
+	transport   string
+	server      string
+	localAddr   string
+	realm       string
+	relayed     netip.AddrPort
+	reflexive   netip.AddrPort
+	lifetime    time.Duration
+	rtt         time.Duration
+	errorCodes  []string
+	errorCode   int
+	errorReason string
+	err         error
+}
+
+// turnCredentialsFromSecret derives TURN REST API credentials from a static auth secret,
+// the scheme used by Calls' TURNStaticAuthSecret and coturn's use-auth-secret.
+func turnCredentialsFromSecret(user, secret string) (string, string) {
+	username := strconv.FormatInt(time.Now().Add(turnSecretCredentialTTL).Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// turnLongTermKey returns the long-term credential key MD5(username ":" realm ":" password)
+// used for MESSAGE-INTEGRITY (RFC 5389 section 15.4).
+func turnLongTermKey(username, realm, password string) []byte {
+	sum := md5.Sum([]byte(username + ":" + realm + ":" + password))
+	return sum[:]
+}
+
+// testTURNAllocate performs an RFC 5766 Allocate with long-term credential authentication.
+// The first unauthenticated request is expected to be challenged with a 401 carrying the
+// realm and nonce; a 438 stale nonce is retried once. A successful allocation is released
+// again with a zero-lifetime Refresh.
+func testTURNAllocate(host string, port int, transport, username, password string, dialer *probeDialer) *turnTestResult {
+	result := &turnTestResult{
+		transport: transport,
+		server:    net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+
+	conn, err := dialStun(host, port, transport, dialer)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer conn.Close()
+	result.localAddr = conn.LocalAddr().String()
+
+	var realm, nonce []byte
+	var key []byte
+
+	for attempt := 0; attempt < 3; attempt++ {
+		req, err := newStunMessage(turnAllocateRequest)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		req.add(turnAttrRequestedTransport, []byte{turnTransportUDP, 0, 0, 0})
+
+		if nonce != nil {
+			req.add(stunAttrUsername, []byte(username))
+			req.add(stunAttrRealm, realm)
+			req.add(stunAttrNonce, nonce)
+			req.addMessageIntegrity(key)
+		}
+
+		resp, rtt, err := stunRoundTrip(conn, transport, req, dialer.timeout)
+		if err != nil {
+			result.err = fmt.Errorf("TURN allocate failed: %w", err)
+			return result
+		}
+		result.rtt = rtt
+
+		if resp.typ == turnAllocateSuccess {
+			return finishTURNAllocate(conn, result, resp, username, realm, nonce, key, dialer.timeout)
+		}
+		if resp.typ != turnAllocateError {
+			result.err = fmt.Errorf("unexpected response type 0x%04x", resp.typ)
+			return result
+		}
+
+		value, _ := resp.get(stunAttrErrorCode)
+		result.errorCode, result.errorReason = decodeStunError(value)
+		result.errorCodes = append(result.errorCodes, fmt.Sprintf("%d %s", result.errorCode, result.errorReason))
+
+		switch {
+		case result.errorCode == turnErrUnauthorized && nonce == nil:
+		case result.errorCode == turnErrStaleNonce:
+		case result.errorCode == turnErrUnauthorized:
+			result.err = fmt.Errorf("credentials rejected for user '%s': %d %s", username, result.errorCode, result.errorReason)
+			return result
+		default:
+			result.err = fmt.Errorf("server returned error %d %s", result.errorCode, result.errorReason)
+			return result
+		}
+
+		if username == "" || password == "" {
+			result.err = fmt.Errorf("server requires authentication (%d %s); set -turn-user and -turn-password or -turn-secret", result.errorCode, result.errorReason)
+			return result
+		}
+
+		newRealm, _ := resp.get(stunAttrRealm)
+		newNonce, ok := resp.get(stunAttrNonce)
+		if !ok {
+			result.err = fmt.Errorf("challenge %d is missing the NONCE attribute", result.errorCode)
+			return result
+		}
+		if newRealm != nil {
+			realm = newRealm
+		}
+		nonce = newNonce
+		result.realm = string(realm)
+
+		key = turnLongTermKey(username, string(realm), password)
+	}
+
+	result.err = fmt.Errorf("giving up after repeated challenges")
+	return result
+}
+
+// finishTURNAllocate extracts the allocation details from a success response and releases it.
+func finishTURNAllocate(conn net.Conn, result *turnTestResult, resp *stunMessage, username string, realm, nonce, key []byte, timeout time.Duration) *turnTestResult {
+	value, ok := resp.get(turnAttrXORRelayedAddress)
+	if !ok {
+		result.err = fmt.Errorf("allocate response has no XOR-RELAYED-ADDRESS")
+		return result
+	}
+	relayed, err := decodeStunAddress(value, true, resp.txID)
+	if err != nil {
+		result.err = fmt.Errorf("invalid relayed address: %w", err)
+		return result
+	}
+	result.relayed = relayed
+
+	if value, ok := resp.get(stunAttrXORMappedAddress); ok {
+		if reflexive, err := decodeStunAddress(value, true, resp.txID); err == nil {
+			result.reflexive = reflexive
+		}
+	}
+	if value, ok := resp.get(turnAttrLifetime); ok && len(value) == 4 {
+		result.lifetime = time.Duration(binary.BigEndian.Uint32(value)) * time.Second
+	}
+	result.success = true
+
+	// Release the allocation so the test does not hold a relay port on the server.
+	refresh, err := newStunMessage(turnRefreshRequest)
+	if err != nil {
+		return result
+	}
+	refresh.add(turnAttrLifetime, []byte{0, 0, 0, 0})
+	if nonce != nil {
+		refresh.add(stunAttrUsername, []byte(username))
+		refresh.add(stunAttrRealm, realm)
+		refresh.add(stunAttrNonce, nonce)
+		refresh.addMessageIntegrity(key)
+	}
+	_, _, _ = stunRoundTrip(conn, result.transport, refresh, timeout)
+
+	return result
+}
+
+// printTURNResult prints a colorized TURN test result.
+func printTURNResult(result *turnTestResult) {
+	if !result.success {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("TURN allocation on %s (%s) failed: %v", result.server, result.transport, result.err))
+		printLikelyCause(result.err)
+		if len(result.errorCodes) > 0 {
+			fmt.Printf("  Error Responses: %s\n", strings.Join(result.errorCodes, ", "))
+		}
+		return
+	}
+
+	fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("TURN allocation on %s (%s) successful", result.server, result.transport))
+	fmt.Printf("  Local Address: %s\n", result.localAddr)
+	if result.reflexive.IsValid() {
+		fmt.Printf("  Reflexive Address: %s\n", result.reflexive)
+	}
+	fmt.Printf("  Relayed Address: %s\n", result.relayed)
+	fmt.Printf("  Lifetime: %v\n", result.lifetime)
+	if result.realm != "" {
+		fmt.Printf("  Realm: %s\n", result.realm)
+	}
+	fmt.Printf("  RTT: %v\n", result.rtt)
+	if len(result.errorCodes) > 0 {
+		fmt.Printf("  Error Responses: %s\n", strings.Join(result.errorCodes, ", "))
+	}
+}
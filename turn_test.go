@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddMessageIntegrityRFC5769LongTerm(t *testing.T) {
+	// RFC 5769 section 2.4, Sample Request with Long-Term Authentication. The
+	// password "The<U+00AD>M<U+00AA>trIX" is "TheMatrIX" after SASLprep.
+	want := mustHex(t, `
+		00 01 00 60 21 12 a4 42 78 ad 34 33 c6 ad 72 c0 29 da 41 2e
+		00 06 00 12 e3 83 9e e3 83 88 e3 83 aa e3 83 83 e3 82 af e3 82 b9 00 00
+		00 15 00 1c 66 2f 2f 34 39 39 6b 39 35 34 64 36 4f 4c 33 34 6f 4c 39 46 53 54 76 79 36 34 73 41
+		00 14 00 0b 65 78 61 6d 70 6c 65 2e 6f 72 67 00
+		00 08 00 14 f6 70 24 65 6d d6 4a 3e 02 b8 e0 71 2e 85 c9 a2 8c a8 96 66`)
+
+	username := "マトリックス"
+	m := &stunMessage{typ: stunBindingRequest}
+	copy(m.txID[:], want[8:20])
+	m.add(stunAttrUsername, []byte(username))
+	m.add(stunAttrNonce, []byte("f//499k954d6OL34oL9FSTvy64sA"))
+	m.add(stunAttrRealm, []byte("example.org"))
+	m.addMessageIntegrity(turnLongTermKey(username, "example.org", "TheMatrIX"))
+
+	if got := m.encode(); !bytes.Equal(got, want) {
+		t.Errorf("encoded message:\n% x\nwant:\n% x", got, want)
+	}
+}
+
+func TestAddMessageIntegrityCoversPrecedingAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		values [][]byte
+	}{
+		{name: "no attributes"},
+		{name: "padded attribute", values: [][]byte{[]byte("user")}},
+		{name: "several attributes", values: [][]byte{{17, 0, 0, 0}, []byte("calls"), []byte("example.com")}},
+	}
+
+	key := turnLongTermKey("calls", "example.com", "secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &stunMessage{typ: turnAllocateRequest, txID: rfc5769TxID}
+			for i, value := range tt.values {
+				m.add(uint16(0x8000+i), value)
+			}
+			m.addMessageIntegrity(key)
+			out := m.encode()
+
+			// Recompute as a server would: HMAC over everything before the attribute.
+			integrity, ok := m.get(stunAttrMessageIntegrity)
+			if !ok {
+				t.Fatal("MESSAGE-INTEGRITY missing")
+			}
+			mac := hmac.New(sha1.New, key)
+			mac.Write(out[:len(out)-sha1.Size-4])
+			if !hmac.Equal(integrity, mac.Sum(nil)) {
+				t.Errorf("MESSAGE-INTEGRITY = % x, want % x", integrity, mac.Sum(nil))
+			}
+			if !bytes.Equal(out[len(out)-sha1.Size:], integrity) {
+				t.Errorf("encoded MESSAGE-INTEGRITY differs from the attribute")
+			}
+		})
+	}
+}
+
+func TestTurnCredentialsFromSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+	}{
+		{name: "with user", user: "calls"},
+		{name: "without user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Add(turnSecretCredentialTTL).Unix()
+			username, password := turnCredentialsFromSecret(tt.user, "static-auth-secret")
+
+			expiry, user, _ := strings.Cut(username, ":")
+			if user != tt.user {
+				t.Errorf("username %q has user %q, want %q", username, user, tt.user)
+			}
+			if ts, err := strconv.ParseInt(expiry, 10, 64); err != nil || ts < before || ts > before+1 {
+				t.Errorf("username %q has expiry %q, want about %d", username, expiry, before)
+			}
+
+			mac := hmac.New(sha1.New, []byte("static-auth-secret"))
+			mac.Write([]byte(username))
+			if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); password != want {
+				t.Errorf("password = %q, want %q", password, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// mattermostModulePrefix selects the Mattermost dependencies listed next to the main module.
+const mattermostModulePrefix = "github.com/mattermost/"
+
+// GetMattermostBuildInfo reads the Go build info embedded in the running Mattermost
+// binary. /proc/<pid>/exe refers to the executable that was started, even if the file
+// on disk has since been replaced by an upgrade.
+func GetMattermostBuildInfo(selector *processSelector) (int, string, *debug.BuildInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	proc, err := findMattermostProcess(ctx, selector)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	exe, _ := proc.Executable()
+	info, err := buildinfo.ReadFile("/proc/" + strconv.Itoa(proc.PID) + "/exe")
+	if err != nil {
+		return proc.PID, exe, nil, fmt.Errorf("failed to read build info of PID %d: %w", proc.PID, err)
+	}
+
+	return proc.PID, exe, info, nil
+}
+
+// PrintMattermostVersion prints the Go build info of the running Mattermost binary.
+func PrintMattermostVersion(selector *processSelector) error {
+	pid, exe, info, err := GetMattermostBuildInfo(selector)
+	if err != nil {
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Field", "Value"})
+
+	if strings.HasSuffix(exe, " (deleted)") {
+		exe = text.Colors{text.Bold, text.FgYellow}.Sprintf("%s (replaced on disk since start)", exe)
+	}
+	t.AppendRow(table.Row{"Executable", exe})
+	t.AppendRow(table.Row{"Go Version", info.GoVersion})
+	t.AppendRow(table.Row{"Package Path", info.Path})
+	t.AppendRow(table.Row{"Main Module", strings.TrimSpace(info.Main.Path + " " + info.Main.Version)})
+	for _, dep := range info.Deps {
+		if strings.HasPrefix(dep.Path, mattermostModulePrefix) {
+			version := dep.Version
+			if dep.Replace != nil {
+				version += " => " + strings.TrimSpace(dep.Replace.Path+" "+dep.Replace.Version)
+			}
+			t.AppendRow(table.Row{"Dependency " + dep.Path, version})
+		}
+	}
+
+	// VCS settings come first as they identify the build; the rest follow in build order.
+	var other []debug.BuildSetting
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			t.AppendRow(table.Row{"VCS Revision", setting.Value})
+		case "vcs.time":
+			t.AppendRow(table.Row{"VCS Time", setting.Value})
+		case "vcs.modified":
+			t.AppendRow(table.Row{"VCS Modified", setting.Value})
+		case "vcs":
+			t.AppendRow(table.Row{"VCS", setting.Value})
+		default:
+			other = append(other, setting)
+		}
+	}
+	for _, setting := range other {
+		t.AppendRow(table.Row{"Build " + setting.Key, setting.Value})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Mattermost Go Build Info (PID %d):", pid))
+	t.Render()
+
+	return nil
+}
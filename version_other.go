@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// GetMattermostBuildInfo is not available outside Linux, where /proc is used.
+func GetMattermostBuildInfo(selector *processSelector) (int, string, *debug.BuildInfo, error) {
+	return 0, "", nil, fmt.Errorf("reading the running binary's build info is %w", errUnsupportedPlatform)
+}
+
+// PrintMattermostVersion is not available outside Linux, where /proc is used.
+func PrintMattermostVersion(selector *processSelector) error {
+	return fmt.Errorf("reading the running binary's build info is %w", errUnsupportedPlatform)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// watchSample is the outcome of a single watch iteration. Consecutive samples with
+// the same state are considered unchanged, so state must not contain timings.
+type watchSample struct {
+	success bool
+	state   string
+	detail  string
+	latency time.Duration
+}
+
+// watchStats are the running counters of a watch session.
+type watchStats struct {
+	runs      int
+	successes int
+	failures  int
+	changes   int
+	latencies []time.Duration
+	started   time.Time
+}
+
+// newWatchCheck returns a silent check for mode that can be run repeatedly. Network
+// modes reuse the batch probes; system modes reuse the Get functions.
+func newWatchCheck(mode string, target batchTarget, dialer *probeDialer, bindIP, iface string, proxyTargets []string, fdWarn, threadWarn float64, selector *processSelector) (func() watchSample, error) {
+	for _, m := range batchModes {
+		if mode == m {
+			return func() watchSample {
+				result := runBatchProbe(target, dialer)
+				sample := watchSample{success: result.success, state: "OK", detail: result.detail, latency: result.latency}
+				if !result.success {
+					sample.state = watchFailureState(result.err, result.detail)
+				}
+				return sample
+			}, nil
+		}
+	}
+
+	if mode == "mm-fds" {
+		// The descriptor count changes constantly, so only crossing the warning
+		// threshold counts as a state change.
+		return func() watchSample {
+			start := time.Now()
+			info, err := GetMattermostFDs(selector)
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			sample := watchSample{success: info.usage() < fdWarn, state: "OK", latency: time.Since(start)}
+			if !sample.success {
+				sample.state = "WARN"
+			}
+			sample.detail = fmt.Sprintf("%d of %s open files (%.1f%%)", info.total, formatUlimitValue(info.softLimit), info.usage())
+			return sample
+		}, nil
+	}
+
+	if mode == "cgroup" {
+		// Usage is reported as detail; only resources crossing their thresholds change the state.
+		return func() watchSample {
+			start := time.Now()
+			info, err := GetMattermostCgroup(selector)
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			problems := info.problems()
+			sample := watchSample{success: len(problems) == 0, state: "OK", detail: info.summary(), latency: time.Since(start)}
+			if !sample.success {
+				sample.state = "WARN: " + strings.Join(problems, ", ")
+			}
+			return sample
+		}, nil
+	}
+
+	if mode == "mm-env" {
+		// As in the mode itself, the Go runtime settings decide the result.
+		return func() watchSample {
+			start := time.Now()
+			envVars, err := GetMattermostProcessEnv(selector)
+			var limits *goRuntimeLimits
+			if err == nil {
+				limits, err = GetMattermostGoRuntimeLimits(selector)
+			}
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			problems := limits.problems()
+			sample := watchSample{success: len(problems) == 0, state: "OK", latency: time.Since(start)}
+			if !sample.success {
+				sample.state = "WARN: " + strings.Join(problems, ", ")
+			}
+			sample.detail = fmt.Sprintf("%d variables, %s", len(envVars), limits.summary())
+			return sample
+		}, nil
+	}
+
+	if mode == "mm-proc" {
+		// Only a restart changes the state; memory and uptime are reported as detail.
+		return func() watchSample {
+			start := time.Now()
+			info, err := GetMattermostProcessOverview(selector)
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			return watchSample{success: true, state: fmt.Sprintf("PID %d", info.pid), detail: info.summary(), latency: time.Since(start)}
+		}, nil
+	}
+
+	if mode == "mm-plugins" {
+		// A plugin process that exits or restarts changes the state. CPU usage is not
+		// sampled, so a check takes no longer than reading /proc.
+		return func() watchSample {
+			start := time.Now()
+			_, plugins, err := GetMattermostPlugins(selector, 0)
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			state := pluginsState(plugins)
+			detail := state
+			if len(plugins) > 0 {
+				detail = pluginsSummary(plugins) + ": " + state
+			}
+			return watchSample{success: true, state: state, detail: detail, latency: time.Since(start)}
+		}, nil
+	}
+
+	if mode == "pressure" {
+		// The kernel's 10 second averages are used instead of sampling a window, and
+		// only resources crossing pressureWarnPercent change the state.
+		return func() watchSample {
+			start := time.Now()
+			report, err := GetPressure(selector, 0)
+			if err != nil {
+				return watchSample{state: err.Error(), detail: err.Error(), latency: time.Since(start)}
+			}
+			problems := report.problems()
+			sample := watchSample{success: len(problems) == 0, state: "OK", detail: report.summary(), latency: time.Since(start)}
+			if !sample.success {
+				sample.state = "WARN: " + strings.Join(problems, ", ")
+			}
+			return sample
+		}, nil
+	}
+
+	var check func() (string, bool, error)
+	switch mode {
+	case "route":
+		check = func() (string, bool, error) {
+			summary, err := RouteSummary(target.host, bindIP, iface)
+			return summary, true, err
+		}
+
+	case "sysctl":
+		check = func() (string, bool, error) {
+			sysctls, err := GetSysctls()
+			if err != nil {
+				return "", false, err
+			}
+			var mismatched []string
+			for _, sysctl := range sysctls {
+				if !sysctl.matches {
+					mismatched = append(mismatched, fmt.Sprintf("%s=%s", sysctl.name, sysctl.actual))
+				}
+			}
+			if len(mismatched) > 0 {
+				return "mismatched " + strings.Join(mismatched, ", "), false, nil
+			}
+			return fmt.Sprintf("%d parameters match", len(sysctls)), true, nil
+		}
+
+	case "ulimits":
+		check = func() (string, bool, error) {
+			ulimits, err := GetUlimits(selector)
+			if err != nil {
+				return "", false, err
+			}
+			var low []string
+			for _, limit := range ulimits {
+				soft, hard := limit.softLimit, limit.hardLimit
+				if limit.processPID != 0 {
+					soft, hard = limit.processSoft, limit.processHard
+				}
+				if soft < limit.expectedSoft || hard < limit.expectedHard {
+					low = append(low, fmt.Sprintf("%s=%s/%s", limit.resourceName, formatUlimitValue(soft), formatUlimitValue(hard)))
+				}
+			}
+			if len(low) > 0 {
+				return "below expected " + strings.Join(low, ", "), false, nil
+			}
+			// Like the mode, a failure to count the threads is not a failed check. The
+			// count itself changes constantly, so only crossing -thread-warn is a state.
+			if len(ulimits) > 0 && ulimits[0].processPID != 0 {
+				if threads, err := GetMattermostUserThreads(selector); err == nil && threads.usage() >= threadWarn {
+					return fmt.Sprintf("threads at %g%% of nproc %s or more", threadWarn, formatUlimitValue(threads.softLimit)), false, nil
+				}
+			}
+			return fmt.Sprintf("%d limits meet expectations", len(ulimits)), true, nil
+		}
+
+	case "mm-proxy":
+		check = func() (string, bool, error) {
+			_, evaluations, err := GetMattermostProxyEvaluation(selector, proxyTargets)
+			if err != nil {
+				return "", false, err
+			}
+			decisions := make([]string, 0, len(evaluations))
+			for _, evaluation := range evaluations {
+				decision := "direct"
+				switch {
+				case evaluation.target.url == nil:
+					decision = "unknown"
+				case evaluation.proxy != nil:
+					decision = evaluation.proxy.Host
+				}
+				decisions = append(decisions, evaluation.target.name+"="+decision)
+			}
+			return strings.Join(decisions, ", "), true, nil
+		}
+
+	case "mm-version":
+		// An upgrade or a binary replaced under the running process changes the state.
+		check = func() (string, bool, error) {
+			_, exe, info, err := GetMattermostBuildInfo(selector)
+			if err != nil {
+				return "", false, err
+			}
+			parts := []string{strings.TrimSpace(info.Main.Path + " " + info.Main.Version), info.GoVersion}
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" {
+					parts = append(parts, "revision "+setting.Value)
+				}
+			}
+			if strings.HasSuffix(exe, " (deleted)") {
+				parts = append(parts, "replaced on disk since start")
+			}
+			return strings.Join(parts, ", "), true, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("-watch is not supported in %s mode", mode)
+	}
+
+	return func() watchSample {
+		start := time.Now()
+		detail, ok, err := check()
+		sample := watchSample{success: ok && err == nil, state: detail, detail: detail, latency: time.Since(start)}
+		if err != nil {
+			sample.state, sample.detail = err.Error(), err.Error()
+		}
+		return sample
+	}, nil
+}
+
+// watchExitCode returns the exit code of a watch in mode that saw failures: network
+// probes fail like a single probe, the other modes like a failed system check.
+func watchExitCode(mode string) int {
+	if mode == "route" {
+		return exitProbeFailed
+	}
+	for _, m := range batchModes {
+		if mode == m {
+			return exitProbeFailed
+		}
+	}
+	return exitSystemCheck
+}
+
+// watchFailureState reduces a failed probe to a stable state, so that timings in the
+// error text don't count as state changes.
+func watchFailureState(err error, detail string) string {
+	if err == nil {
+		return "FAIL: " + detail
+	}
+	if info := classifyConnError(err); info.hint != "" {
+		return "FAIL: " + info.name
+	}
+	return "FAIL"
+}
+
+// percentileDuration returns the nearest-rank percentile p (0-100) of sorted durations.
+func percentileDuration(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// runWatch runs check every interval until interrupted, printing only state changes,
+// and prints the counters when it stops.
+func runWatch(description string, interval time.Duration, check func() watchSample) *watchStats {
+	stats := &watchStats{started: time.Now()}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("%s\n", text.Colors{text.Bold}.Sprintf("Watching %s every %v (Ctrl-C to stop)", description, interval))
+
+	var last *watchSample
+	var lastChange time.Time
+	for {
+		sample := check()
+		now := time.Now()
+
+		stats.runs++
+		if sample.success {
+			stats.successes++
+			stats.latencies = append(stats.latencies, sample.latency)
+		} else {
+			stats.failures++
+		}
+
+		if last == nil || sample.state != last.state {
+			status := text.Colors{text.Bold, text.FgGreen}.Sprint("OK  ")
+			if !sample.success {
+				status = text.Colors{text.Bold, text.FgRed}.Sprint("FAIL")
+			}
+			previous := ""
+			if last != nil {
+				stats.changes++
+				previous = fmt.Sprintf(" (previous state lasted %v)", now.Sub(lastChange).Round(time.Second))
+			}
+			fmt.Printf("%s %s %v %s%s [%s]\n", now.Format(time.RFC3339), status,
+				sample.latency.Round(time.Microsecond), sample.detail, previous, stats.counters())
+			lastChange = now
+		}
+		last = &sample
+
+		select {
+		case <-signals:
+			printWatchStats(stats)
+			return stats
+		case <-ticker.C:
+		}
+	}
+}
+
+// counters returns the running success and failure counts and, once a run succeeded,
+// the latency percentiles of the successful runs.
+func (s *watchStats) counters() string {
+	counters := fmt.Sprintf("ok %d, fail %d", s.successes, s.failures)
+	if len(s.latencies) == 0 {
+		return counters
+	}
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return fmt.Sprintf("%s, p50 %v, p90 %v, p99 %v", counters,
+		percentileDuration(sorted, 50).Round(time.Microsecond),
+		percentileDuration(sorted, 90).Round(time.Microsecond),
+		percentileDuration(sorted, 99).Round(time.Microsecond))
+}
+
+// printWatchStats prints the counters and latency percentiles of a watch session.
+func printWatchStats(stats *watchStats) {
+	sorted := append([]time.Duration(nil), stats.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Field", "Value"})
+	t.AppendRow(table.Row{"Duration", time.Since(stats.started).Round(time.Second)})
+	t.AppendRow(table.Row{"Runs", stats.runs})
+	t.AppendRow(table.Row{"Successes", stats.successes})
+	t.AppendRow(table.Row{"Failures", stats.failures})
+	t.AppendRow(table.Row{"State Changes", stats.changes})
+	if len(sorted) > 0 {
+		t.AppendRow(table.Row{"Latency min", sorted[0].Round(time.Microsecond)})
+		t.AppendRow(table.Row{"Latency p50", percentileDuration(sorted, 50).Round(time.Microsecond)})
+		t.AppendRow(table.Row{"Latency p90", percentileDuration(sorted, 90).Round(time.Microsecond)})
+		t.AppendRow(table.Row{"Latency p99", percentileDuration(sorted, 99).Round(time.Microsecond)})
+		t.AppendRow(table.Row{"Latency max", sorted[len(sorted)-1].Round(time.Microsecond)})
+	}
+
+	t.SetStyle(table.StyleDefault)
+	fmt.Printf("\n%s\n", text.Colors{text.Bold}.Sprint("Watch Summary:"))
+	t.Render()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchCheckFailsOnSilentSTARTTLSServer(t *testing.T) {
+	// The listener accepts connections but never answers the STARTTLS request.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	dialer, err := newProbeDialer("", false, "", "", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("newProbeDialer: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	for _, mode := range []string{"tls-postgres", "tls-ldap"} {
+		t.Run(mode, func(t *testing.T) {
+			target, err := parseBatchLine("-mode "+mode+" -host 127.0.0.1 -port "+strconv.Itoa(port), 1)
+			if err != nil {
+				t.Fatalf("parseBatchLine: %v", err)
+			}
+			check, err := newWatchCheck(mode, target, dialer, "", "", nil, 0, 0, nil)
+			if err != nil {
+				t.Fatalf("newWatchCheck: %v", err)
+			}
+
+			done := make(chan watchSample, 1)
+			go func() { done <- check() }()
+			select {
+			case sample := <-done:
+				if sample.success {
+					t.Fatalf("sample = %+v, want failure", sample)
+				}
+				if !strings.HasPrefix(sample.state, "FAIL") {
+					t.Errorf("state = %q, want FAIL", sample.state)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("check did not return on a silent server")
+			}
+		})
+	}
+}
+
+func TestPercentileDuration(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, v := range values {
+			durations[i] = time.Duration(v) * time.Millisecond
+		}
+		return durations
+	}
+	ten := ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	hundred := make([]time.Duration, 100)
+	for i := range hundred {
+		hundred[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{name: "empty", sorted: nil, p: 50, want: 0},
+		{name: "one sample p50", sorted: ms(7), p: 50, want: 7 * time.Millisecond},
+		{name: "one sample p99", sorted: ms(7), p: 99, want: 7 * time.Millisecond},
+		{name: "three samples p50", sorted: ms(1, 2, 3), p: 50, want: 2 * time.Millisecond},
+		{name: "three samples p90", sorted: ms(1, 2, 3), p: 90, want: 3 * time.Millisecond},
+		{name: "ten samples p50", sorted: ten, p: 50, want: 5 * time.Millisecond},
+		{name: "ten samples p90", sorted: ten, p: 90, want: 9 * time.Millisecond},
+		{name: "ten samples p99 rounds up to the last", sorted: ten, p: 99, want: 10 * time.Millisecond},
+		{name: "hundred samples p99", sorted: hundred, p: 99, want: 99 * time.Millisecond},
+		{name: "p0 is the minimum", sorted: ten, p: 0, want: 1 * time.Millisecond},
+		{name: "p100 is the maximum", sorted: ten, p: 100, want: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentileDuration(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentileDuration(p%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchFailureState(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	tests := []struct {
+		name   string
+		err    error
+		detail string
+		want   string
+	}{
+		{name: "no error keeps the detail", detail: "database_status=UNHEALTHY", want: "FAIL: database_status=UNHEALTHY"},
+		{name: "classified error drops timings", err: refused, detail: "dial tcp 10.0.0.1:5432 after 12ms", want: "FAIL: connection refused"},
+		{name: "unclassified error", err: errors.New("server returned 502 Bad Gateway"), want: "FAIL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := watchFailureState(tt.err, tt.detail); got != tt.want {
+				t.Errorf("watchFailureState = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchExitCode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{mode: "tcp", want: exitProbeFailed},
+		{mode: "tls-postgres", want: exitProbeFailed},
+		{mode: "http", want: exitProbeFailed},
+		{mode: "websocket", want: exitProbeFailed},
+		{mode: "route", want: exitProbeFailed},
+		{mode: "sysctl", want: exitSystemCheck},
+		{mode: "ulimits", want: exitSystemCheck},
+		{mode: "mm-env", want: exitSystemCheck},
+		{mode: "mm-fds", want: exitSystemCheck},
+		{mode: "cgroup", want: exitSystemCheck},
+		{mode: "pressure", want: exitSystemCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if got := watchExitCode(tt.mode); got != tt.want {
+				t.Errorf("watchExitCode(%q) = %d, want %d", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
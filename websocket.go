@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	mattermostWebSocketPath = "/api/v4/websocket"
+
+	// websocketGUID is the fixed GUID used to derive Sec-WebSocket-Accept (RFC 6455 section 1.3).
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// websocketTestResult contains information about a WebSocket upgrade test.
+type websocketTestResult struct {
+	upgraded      bool
+	gotHello      bool
+	url           string
+	statusCode    int
+	status        string
+	headers       http.Header
+	serverVersion string
+	connectionID  string
+	handshake     time.Duration
+	helloAfter    time.Duration
+	survived      time.Duration
+	closeReason   string
+	err           error
+}
+
+// success reports whether the upgrade worked and the connection lasted as long as requested.
+// Without a token Mattermost never sends hello, so only the upgrade and survival are checked.
+func (r *websocketTestResult) success(token string) bool {
+	return r.upgraded && r.err == nil && (token == "" || r.gotHello)
+}
+
+// websocketFrame is a single decoded WebSocket frame.
+type websocketFrame struct {
+	opcode  byte
+	payload []byte
+}
+
+// testWebSocket performs an RFC 6455 upgrade against the Mattermost WebSocket endpoint,
+// waits for the hello event and keeps the connection open for up to duration.
+func testWebSocket(baseURL, sni, token string, insecure bool, dialer *probeDialer, duration time.Duration) *websocketTestResult {
+	result := &websocketTestResult{}
+
+	u, err := url.Parse(baseURL + mattermostWebSocketPath)
+	if err != nil {
+		result.err = fmt.Errorf("invalid URL: %w", err)
+		return result
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		u.Scheme = "wss"
+	case "http", "ws":
+		u.Scheme = "ws"
+	default:
+		result.err = fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+		return result
+	}
+	result.url = u.String()
+
+	address := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	start := time.Now()
+
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		serverName := u.Hostname()
+		if sni != "" {
+			serverName = sni
+		}
+		conn, err = dialer.DialTLS("tcp", address, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: insecure,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		result.err = fmt.Errorf("failed to connect to %s: %w", address, err)
+		return result
+	}
+	defer conn.Close()
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		result.err = fmt.Errorf("failed to generate WebSocket key: %w", err)
+		return result
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		result.err = fmt.Errorf("invalid request: %w", err)
+		return result
+	}
+	req.URL.Scheme = strings.Replace(req.URL.Scheme, "ws", "http", 1)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("User-Agent", "mmdebug")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(dialer.timeout)); err != nil {
+		result.err = fmt.Errorf("failed to set deadline: %w", err)
+		return result
+	}
+	if err := req.Write(conn); err != nil {
+		result.err = fmt.Errorf("failed to send upgrade request: %w", err)
+		return result
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		result.err = fmt.Errorf("failed to read upgrade response: %w", err)
+		return result
+	}
+	resp.Body.Close()
+	result.handshake = time.Since(start)
+	result.statusCode = resp.StatusCode
+	result.status = resp.Status
+	result.headers = resp.Header
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		result.err = fmt.Errorf("upgrade rejected with %s", resp.Status)
+		return result
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		result.err = fmt.Errorf("response is missing 'Upgrade: websocket' (got '%s')", resp.Header.Get("Upgrade"))
+		return result
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		result.err = fmt.Errorf("invalid Sec-WebSocket-Accept '%s'", resp.Header.Get("Sec-WebSocket-Accept"))
+		return result
+	}
+	result.upgraded = true
+
+	upgraded := time.Now()
+	if err := conn.SetDeadline(upgraded.Add(duration)); err != nil {
+		result.err = fmt.Errorf("failed to set deadline: %w", err)
+		return result
+	}
+
+	for {
+		frame, err := readWebSocketFrame(reader)
+		if err != nil {
+			result.survived = time.Since(upgraded)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// Reaching the deadline means the connection outlived the requested duration.
+				if token != "" && !result.gotHello {
+					result.err = fmt.Errorf("no hello event received within %v", duration)
+				}
+				return result
+			}
+			result.err = fmt.Errorf("connection dropped after %v: %w", result.survived.Round(time.Millisecond), err)
+			return result
+		}
+
+		switch frame.opcode {
+		case wsOpPing:
+			if err := writeWebSocketFrame(conn, wsOpPong, frame.payload); err != nil {
+				result.survived = time.Since(upgraded)
+				result.err = fmt.Errorf("failed to answer ping: %w", err)
+				return result
+			}
+		case wsOpClose:
+			result.survived = time.Since(upgraded)
+			result.closeReason = websocketCloseReason(frame.payload)
+			result.err = fmt.Errorf("server closed the connection after %v: %s", result.survived.Round(time.Millisecond), result.closeReason)
+			return result
+		case wsOpText:
+			var event struct {
+				Event string         `json:"event"`
+				Data  map[string]any `json:"data"`
+			}
+			if json.Unmarshal(frame.payload, &event) != nil || event.Event != "hello" || result.gotHello {
+				continue
+			}
+			result.gotHello = true
+			result.helloAfter = time.Since(upgraded)
+			if version, ok := event.Data["server_version"].(string); ok {
+				result.serverVersion = version
+			}
+			if id, ok := event.Data["connection_id"].(string); ok {
+				result.connectionID = id
+			}
+		}
+	}
+}
+
+// readWebSocketFrame reads a single unmasked frame sent by the server.
+// Fragmented messages are returned frame by frame, which is enough to spot the hello event.
+func readWebSocketFrame(r *bufio.Reader) (*websocketFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	frame := &websocketFrame{opcode: header[0] & 0x0f}
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	masked := header[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if length > httpMaxBodySize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds limit", length)
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= mask[i%4]
+		}
+	}
+
+	return frame, nil
+}
+
+// writeWebSocketFrame writes a single masked frame, as required for clients.
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// websocketCloseReason formats the status code and reason of a close frame.
+func websocketCloseReason(payload []byte) string {
+	if len(payload) < 2 {
+		return "no status code"
+	}
+	code := binary.BigEndian.Uint16(payload[:2])
+	if len(payload) > 2 {
+		return fmt.Sprintf("%d %s", code, payload[2:])
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+// printWebSocketResult prints a colorized WebSocket test result. When the upgrade fails
+// the response headers are shown, since proxies stripping Upgrade are the usual cause.
+func printWebSocketResult(result *websocketTestResult, token string) {
+	if !result.upgraded {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("WebSocket upgrade to %s failed: %v", result.url, result.err))
+		printLikelyCause(result.err)
+		if result.statusCode == 0 {
+			return
+		}
+
+		fmt.Printf("  Response: %s\n", result.status)
+		names := make([]string, 0, len(result.headers))
+		for name := range result.headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, strings.Join(result.headers[name], ", "))
+		}
+		return
+	}
+
+	if result.success(token) {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgGreen}.Sprintf("WebSocket connection to %s successful", result.url))
+	} else {
+		fmt.Printf("%s\n", text.Colors{text.Bold, text.FgRed}.Sprintf("WebSocket connection to %s failed: %v", result.url, result.err))
+	}
+	fmt.Printf("  Handshake: %v\n", result.handshake)
+
+	switch {
+	case result.gotHello:
+		fmt.Printf("  Hello Event: received after %v\n", result.helloAfter)
+		if result.serverVersion != "" {
+			fmt.Printf("  Server Version: %s\n", result.serverVersion)
+		}
+		if result.connectionID != "" {
+			fmt.Printf("  Connection ID: %s\n", result.connectionID)
+		}
+	case token == "":
+		fmt.Printf("  Hello Event: not expected without -token\n")
+	default:
+		fmt.Printf("  Hello Event: %s\n", text.Colors{text.Bold, text.FgRed}.Sprint("not received"))
+	}
+
+	fmt.Printf("  Connection Lifetime: %v\n", result.survived.Round(time.Millisecond))
+}